@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/demiazz/avify/convert"
+	"github.com/demiazz/avify/internal/vips"
+)
+
+// Admission holds what discovery learns about the directories of a root on
+// the way down: inherited settings and ignore rules, and which directories
+// are skipped. Walking the tree and reading a work list both go through it,
+// so listed files get exactly the filters of a walk.
+type Admission struct {
+	Discovery *Discovery
+
+	root       string
+	extensions *regexp.Regexp
+	params     map[string]*vips.AvifExportParams
+	formats    map[string][]string
+	ignores    map[string][]IgnoreRule
+	dirs       map[string]SkipReason
+}
+
+// NewAdmission reports admitted files to observer as they are discovered.
+func NewAdmission(root string, observer convert.Observer) (*Admission, error) {
+	if err := CheckSafeRoot(root); err != nil {
+		return nil, err
+	}
+
+	r, err := regexp.Compile(AllowedExtensions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	discovery := &Discovery{Skipped: map[SkipReason]int{}, observer: observer}
+
+	if DiscoveryStats {
+		discovery.Histogram = NewHistogram()
+	}
+
+	return &Admission{
+		Discovery:  discovery,
+		root:       root,
+		extensions: r,
+		params:     map[string]*vips.AvifExportParams{},
+		formats:    map[string][]string{},
+		ignores:    map[string][]IgnoreRule{},
+		dirs:       map[string]SkipReason{},
+	}, nil
+}
+
+// EnterDir checks the directory at path, whose parent was entered already,
+// and loads its ignore files and settings for what is below. It returns the
+// reason the directory is skipped for, if it is.
+func (a *Admission) EnterDir(path string) (SkipReason, error) {
+	path = filepath.Clean(path)
+
+	if reason, ok := a.dirs[path]; ok {
+		return reason, nil
+	}
+
+	reason, err := a.enterDir(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	a.dirs[path] = reason
+
+	return reason, nil
+}
+
+func (a *Admission) enterDir(path string) (SkipReason, error) {
+	parent := filepath.Dir(path)
+
+	if IsExcluded(a.root, path) {
+		return SkipExcluded, nil
+	}
+
+	if IsIgnored(a.ignores[parent], path, true) {
+		return SkipIgnored, nil
+	}
+
+	if path != filepath.Clean(a.root) && IsUnsafeDir(filepath.Base(path)) {
+		return "", fmt.Errorf("%s: %w", path, ErrUnsafePath)
+	}
+
+	if !ReadOnlySource && OutputDir == "" && IsReadOnly(path) {
+		a.Discovery.ReadOnly = append(a.Discovery.ReadOnly, path)
+
+		return SkipReadOnly, nil
+	}
+
+	if RespectGitignore && filepath.Base(path) == ".git" {
+		return SkipIgnored, nil
+	}
+
+	rules, err := LoadIgnoreFiles(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	a.ignores[path] = append(slices.Clip(a.ignores[parent]), rules...)
+
+	inherited := a.params[parent]
+
+	settings, source, err := LoadDirSettings(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	if settings == nil {
+		a.params[path] = inherited
+		a.formats[path] = a.formats[parent]
+
+		return "", nil
+	}
+
+	if inherited == nil {
+		inherited = AvifExportParams
+	}
+
+	overridden, formats, skip, err := ApplySettings(inherited, a.formats[parent], settings)
+
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", source, err)
+	}
+
+	if skip {
+		return SkipSettings, nil
+	}
+
+	a.params[path] = overridden
+	a.formats[path] = formats
+
+	return "", nil
+}
+
+// AdmitFile checks a file of an entered directory, and adds its job unless
+// one of the checks skips it.
+func (a *Admission) AdmitFile(path string, mode fs.FileMode, stat func() (fs.FileInfo, error)) error {
+	dir := filepath.Dir(path)
+
+	if IsExcluded(a.root, path) {
+		a.Discovery.Skip(SkipExcluded, path)
+
+		return nil
+	}
+
+	if IsIgnored(a.ignores[dir], path, false) {
+		a.Discovery.Skip(SkipIgnored, path)
+
+		return nil
+	}
+
+	if name := filepath.Base(path); IsSettingsFile(name) || name == IgnoreFileName {
+		return nil
+	}
+
+	if !mode.IsRegular() {
+		a.Discovery.Skip(SkipIrregular, path)
+
+		return nil
+	}
+
+	if formats := a.formats[dir]; formats != nil && !HasExtension(path, formats) {
+		a.Discovery.Skip(SkipFormat, path)
+
+		return nil
+	}
+
+	job := &Job{Root: a.root, Path: path, Params: a.params[dir]}
+
+	return a.Discovery.Admit(a.extensions, job, stat)
+}
+
+// AdmitListed admits a file named in a work list, entering the directories
+// between the root and the file first, as a walk down to it would. The path
+// is taken relative to the root the way a walk would name it.
+func (a *Admission) AdmitListed(path string) error {
+	rel, err := relativeTo(a.root, path)
+
+	if err != nil {
+		return err
+	}
+
+	path = filepath.Join(a.root, rel)
+
+	info, err := os.Lstat(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		a.Discovery.Skip(SkipMissing, path)
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	dir := a.root
+	dirs := []string{dir}
+
+	if parent := filepath.Dir(rel); parent != "." {
+		for _, part := range strings.Split(parent, string(filepath.Separator)) {
+			dir = filepath.Join(dir, part)
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, dir := range dirs {
+		reason, err := a.EnterDir(dir)
+
+		if err != nil {
+			return err
+		}
+
+		if reason != "" {
+			a.Discovery.Skip(reason, path)
+
+			return nil
+		}
+	}
+
+	return a.AdmitFile(path, info.Mode(), func() (fs.FileInfo, error) {
+		return info, nil
+	})
+}
+
+func relativeTo(root, path string) (string, error) {
+	root, err := filepath.Abs(root)
+
+	if err != nil {
+		return "", err
+	}
+
+	path, err = filepath.Abs(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Rel(root, path)
+}
+
+// SkipOutside records the paths that are under none of the roots.
+func (d *Discovery) SkipOutside(paths, roots []string) {
+	for _, path := range paths {
+		within := slices.ContainsFunc(roots, func(root string) bool {
+			return IsWithin(path, root)
+		})
+
+		if !within {
+			d.Skip(SkipOutsideRoots, path)
+		}
+	}
+}
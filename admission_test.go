@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func jobPaths(discovery *Discovery) []string {
+	var paths []string
+
+	for _, job := range discovery.Jobs {
+		paths = append(paths, job.Path)
+	}
+
+	slices.Sort(paths)
+
+	return paths
+}
+
+// Listed files must go through exactly the filters of a walk.
+func TestFindListedImagesAtMatchesWalk(t *testing.T) {
+	image, err := os.ReadFile(filepath.Join("testdata", "complete.png"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := writeTree(t, map[string]string{
+		"a.png":                    string(image),
+		"notes.txt":                "",
+		"ignored/b.png":            string(image),
+		"nested/c.png":             string(image),
+		"nested/" + IgnoreFileName: "d.png\n",
+		"nested/d.png":             string(image),
+		"skipped/" + RCFileName:    "skip = true\n",
+		"skipped/e.png":            string(image),
+		IgnoreFileName:             "ignored/\n",
+	})
+
+	walked, err := FindImagesAt(root)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var listed []string
+
+	for _, name := range []string{"a.png", "notes.txt", "ignored/b.png", "nested/c.png", "nested/d.png", "skipped/e.png", "missing.png"} {
+		listed = append(listed, filepath.Join(root, filepath.FromSlash(name)))
+	}
+
+	found, err := FindListedImagesAt(root, listed)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{filepath.Join(root, "a.png"), filepath.Join(root, "nested", "c.png")}
+
+	if got := jobPaths(walked); !slices.Equal(got, want) {
+		t.Errorf("walk found %v, want %v", got, want)
+	}
+
+	if got := jobPaths(found); !slices.Equal(got, want) {
+		t.Errorf("list found %v, want %v", got, want)
+	}
+
+	for _, reason := range []SkipReason{SkipIgnored, SkipSettings, SkipMissing} {
+		if found.Skipped[reason] == 0 {
+			t.Errorf("no listed file skipped as %q", reason)
+		}
+	}
+}
+
+func TestSkipOutside(t *testing.T) {
+	discovery := &Discovery{Skipped: map[SkipReason]int{}}
+
+	discovery.SkipOutside([]string{"/photos/a.jpg", "/scans/b.jpg", "/other/c.jpg"}, []string{"/photos", "/scans"})
+
+	if discovery.Skipped[SkipOutsideRoots] != 1 {
+		t.Errorf("skipped %d paths as outside the roots, want 1", discovery.Skipped[SkipOutsideRoots])
+	}
+}
+
+func TestFindReportedImagesAtFilters(t *testing.T) {
+	image, err := os.ReadFile(filepath.Join("testdata", "complete.png"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := writeTree(t, map[string]string{
+		"a.png":         string(image),
+		"ignored/b.png": string(image),
+		IgnoreFileName:  "ignored/\n",
+	})
+
+	report := &Report{Files: []*Result{
+		{Path: filepath.Join(root, "a.png"), Status: StatusFailed},
+		{Path: filepath.Join(root, "ignored", "b.png"), Status: StatusFailed},
+	}}
+
+	found, err := FindReportedImagesAt(root, report, []string{SubsetFailed})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := jobPaths(found), []string{filepath.Join(root, "a.png")}; !slices.Equal(got, want) {
+		t.Errorf("found %v, want %v", got, want)
+	}
+}
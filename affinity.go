@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var CPUAffinity = ""
+
+var NUMANode = -1
+
+// ParseCPUList parses lists like "0-15,32-47" as used by taskset and sysfs.
+func ParseCPUList(list string) ([]int, error) {
+	var cpus []int
+
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		if part == "" {
+			continue
+		}
+
+		low, high, isRange := strings.Cut(part, "-")
+
+		first, err := strconv.Atoi(low)
+
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("invalid CPU list %q", list)
+		}
+
+		last := first
+
+		if isRange {
+			last, err = strconv.Atoi(high)
+
+			if err != nil || last < first {
+				return nil, fmt.Errorf("invalid CPU list %q", list)
+			}
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("empty CPU list %q", list)
+	}
+
+	return cpus, nil
+}
+
+func NUMANodeCPUs(node int) ([]int, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/sys/devices/system/node/node%d/cpulist", node))
+
+	if err != nil {
+		return nil, fmt.Errorf("NUMA node %d: %w", node, err)
+	}
+
+	return ParseCPUList(string(data))
+}
+
+// ConfigureAffinity pins the process to the requested CPUs, or to the CPUs of
+// the requested NUMA node so libvips allocations stay local to it, and sizes
+// the worker pool to match.
+func ConfigureAffinity() error {
+	var cpus []int
+	var err error
+
+	switch {
+	case CPUAffinity != "":
+		cpus, err = ParseCPUList(CPUAffinity)
+	case NUMANode >= 0:
+		cpus, err = NUMANodeCPUs(NUMANode)
+	default:
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := SetAffinity(cpus); err != nil {
+		return err
+	}
+
+	Concurrency = min(Concurrency, len(cpus))
+
+	return nil
+}
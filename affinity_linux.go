@@ -0,0 +1,43 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetAffinity pins every thread of the process, since Linux affinity is per
+// thread. Threads started later, including the libvips pool, inherit it.
+func SetAffinity(cpus []int) error {
+	var set unix.CPUSet
+
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+
+	tasks, err := os.ReadDir("/proc/self/task")
+
+	if err != nil {
+		return unix.SchedSetaffinity(0, &set)
+	}
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+
+		if err != nil {
+			continue
+		}
+
+		if err := unix.SchedSetaffinity(tid, &set); err != nil && err != unix.ESRCH {
+			return err
+		}
+	}
+
+	runtime.GOMAXPROCS(len(cpus))
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+var Premultiply = false
+
+var AlphaBleed = false
+
+var AlphaBleedSigma = 4.0
+
+var ErrAlphaMode = errors.New("--premultiply and --alpha-bleed are mutually exclusive")
+
+// PrepareAlpha cleans up the color hidden under transparent pixels, which
+// otherwise bleeds into visible edges as a halo once chroma is subsampled or
+// the image is scaled.
+func PrepareAlpha(image *vips.ImageRef) error {
+	if !image.HasAlpha() {
+		return nil
+	}
+
+	if Premultiply {
+		return premultiply(image)
+	}
+
+	if AlphaBleed {
+		return bleedAlpha(image)
+	}
+
+	return nil
+}
+
+// premultiply round-trips the color through premultiplied alpha, so fully
+// transparent pixels carry black instead of whatever the editor left there.
+func premultiply(image *vips.ImageRef) error {
+	if err := image.PremultiplyAlpha(); err != nil {
+		return err
+	}
+
+	return image.UnpremultiplyAlpha()
+}
+
+// bleedAlpha fills fully transparent pixels with the alpha weighted blur of
+// their visible neighbours, keeping every visible pixel as is.
+func bleedAlpha(image *vips.ImageRef) error {
+	format := image.BandFormat()
+	bands := image.Bands()
+
+	alpha, err := image.ExtractBandToImage(bands-1, 1)
+
+	if err != nil {
+		return err
+	}
+
+	defer alpha.Close()
+
+	visible, hidden, err := alphaMasks(alpha)
+
+	if err != nil {
+		return err
+	}
+
+	defer visible.Close()
+	defer hidden.Close()
+
+	bled, err := image.Copy()
+
+	if err != nil {
+		return err
+	}
+
+	defer bled.Close()
+
+	if err := bled.PremultiplyAlpha(); err != nil {
+		return err
+	}
+
+	if err := bled.GaussianBlur(AlphaBleedSigma); err != nil {
+		return err
+	}
+
+	if err := bled.UnpremultiplyAlpha(); err != nil {
+		return err
+	}
+
+	if err := bled.ExtractBand(0, bands-1); err != nil {
+		return err
+	}
+
+	if err := bled.Multiply(hidden); err != nil {
+		return err
+	}
+
+	if err := image.ExtractBand(0, bands-1); err != nil {
+		return err
+	}
+
+	if err := image.Multiply(visible); err != nil {
+		return err
+	}
+
+	if err := image.Add(bled); err != nil {
+		return err
+	}
+
+	if err := image.BandJoin(alpha); err != nil {
+		return err
+	}
+
+	return image.Cast(format)
+}
+
+// alphaMasks returns 1 for pixels with any alpha and 0 for fully transparent
+// ones, and the inverse.
+func alphaMasks(alpha *vips.ImageRef) (*vips.ImageRef, *vips.ImageRef, error) {
+	visible, err := alpha.Copy()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = visible.Linear1(255, 0)
+
+	if err == nil {
+		err = visible.Cast(vips.BandFormatUchar)
+	}
+
+	if err == nil {
+		err = visible.Linear1(1.0/255, 0)
+	}
+
+	if err != nil {
+		visible.Close()
+
+		return nil, nil, err
+	}
+
+	hidden, err := visible.Copy()
+
+	if err != nil {
+		visible.Close()
+
+		return nil, nil, err
+	}
+
+	if err := hidden.Linear1(-1, 1); err != nil {
+		visible.Close()
+		hidden.Close()
+
+		return nil, nil, err
+	}
+
+	return visible, hidden, nil
+}
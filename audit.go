@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	AuditDelete    = "delete"
+	AuditOverwrite = "overwrite"
+)
+
+var AuditLog io.WriteCloser
+
+var auditMu sync.Mutex
+
+// Audit records an action before it is taken. An action that can't be
+// recorded must not be taken, so callers give up on its error.
+func Audit(action string, path string, fields ...string) error {
+	if AuditLog == nil {
+		return nil
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "run=%s action=%s path=%s", RunID, action, strconv.Quote(path))
+
+	for i := 0; i+1 < len(fields); i += 2 {
+		fmt.Fprintf(&b, " %s=%s", fields[i], strconv.Quote(fields[i+1]))
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if _, err := AuditLog.Write([]byte(b.String())); err != nil {
+		return fmt.Errorf("failed to audit %s of %s: %w", action, path, err)
+	}
+
+	if syncer, ok := AuditLog.(interface{ Sync() error }); ok {
+		if err := syncer.Sync(); err != nil {
+			return fmt.Errorf("failed to audit %s of %s: %w", action, path, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+func OpenAuditLog() (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not available on this platform")
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type failingLog struct{}
+
+func (failingLog) Write([]byte) (int, error) {
+	return 0, errors.New("no space left on device")
+}
+
+func (failingLog) Close() error {
+	return nil
+}
+
+func TestAuditFailsOverwrite(t *testing.T) {
+	defer func(log io.WriteCloser) { AuditLog = log }(AuditLog)
+
+	AuditLog = failingLog{}
+
+	path := filepath.Join(t.TempDir(), "image.avif")
+
+	if err := (FileSink{}).Write(path, []byte("old")); err != nil {
+		t.Fatalf("writing a new file: %v", err)
+	}
+
+	if err := (FileSink{}).Write(path, []byte("new")); err == nil {
+		t.Error("overwrite succeeded without an audit record")
+	}
+
+	if data, err := os.ReadFile(path); err != nil || string(data) != "old" {
+		t.Errorf("read %q (%v) after a failed audit, want the old file", data, err)
+	}
+}
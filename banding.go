@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+const bandingSampleSize = 512
+
+var ErrSampleMismatch = errors.New("source and output samples differ in size")
+
+func GrayscaleSample(image *vips.ImageRef) ([]byte, int, int, error) {
+	sample, err := image.Copy()
+
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	defer sample.Close()
+
+	if longest := max(sample.Width(), sample.Height()); longest > bandingSampleSize {
+		if err := sample.Resize(float64(bandingSampleSize)/float64(longest), vips.KernelLinear); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	if err := sample.ToColorSpace(vips.InterpretationBW); err != nil {
+		return nil, 0, 0, err
+	}
+
+	if sample.BandFormat() == vips.BandFormatUshort {
+		if err := sample.Linear1(1.0/257, 0); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	if err := sample.ExtractBand(0, 1); err != nil {
+		return nil, 0, 0, err
+	}
+
+	if err := sample.Cast(vips.BandFormatUchar); err != nil {
+		return nil, 0, 0, err
+	}
+
+	data, err := sample.ToBytes()
+
+	return data, sample.Width(), sample.Height(), err
+}
+
+func MeasureBanding(source *vips.ImageRef, encoded []byte) (float64, error) {
+	output, err := vips.NewImageFromBuffer(encoded)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer output.Close()
+
+	before, width, height, err := GrayscaleSample(source)
+
+	if err != nil {
+		return 0, err
+	}
+
+	after, outputWidth, outputHeight, err := GrayscaleSample(output)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if width != outputWidth || height != outputHeight || len(before) != len(after) {
+		return 0, ErrSampleMismatch
+	}
+
+	return BandingScore(before, after, width, height), nil
+}
+
+// BandingScore returns the share of tonal change inside smooth source areas
+// (neighbouring steps of at most one level) that the output concentrated into
+// steps of four levels or more, which is how banding shows up in gradients.
+func BandingScore(before, after []byte, width, height int) float64 {
+	var total, stepped int
+
+	check := func(a, b, c int) {
+		if absDiff(before[a], before[b]) > 1 || absDiff(before[b], before[c]) > 1 {
+			return
+		}
+
+		change := absDiff(after[b], after[c])
+
+		total += change
+
+		if change >= 4 {
+			stepped += change
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 2; x < width; x++ {
+			i := y*width + x
+
+			check(i-2, i-1, i)
+		}
+	}
+
+	for y := 2; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+
+			check(i-2*width, i-width, i)
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return float64(stepped) / float64(total)
+}
+
+func absDiff(a, b byte) int {
+	if a > b {
+		return int(a - b)
+	}
+
+	return int(b - a)
+}
@@ -0,0 +1,50 @@
+package main
+
+import "os"
+
+var BatchThreshold int64 = 32 * 1024
+
+var MaxBatchSize = 32
+
+// BatchJobs groups files smaller than BatchThreshold so that a worker converts
+// several of them per task. Batches shrink when few small files are left, so
+// every worker still gets a share of them and progress keeps moving.
+func BatchJobs(jobs []*Job, workers int) [][]*Job {
+	var small []*Job
+
+	batches := make([][]*Job, 0, len(jobs))
+
+	for _, job := range jobs {
+		if BatchThreshold <= 0 || MaxBatchSize <= 1 {
+			batches = append(batches, []*Job{job})
+
+			continue
+		}
+
+		info, err := os.Stat(job.Path)
+
+		if err != nil || info.Size() >= BatchThreshold {
+			batches = append(batches, []*Job{job})
+
+			continue
+		}
+
+		small = append(small, job)
+	}
+
+	if len(small) == 0 {
+		return batches
+	}
+
+	size := len(small) / (max(workers, 1) * 4)
+	size = max(1, min(size, MaxBatchSize))
+
+	for len(small) > 0 {
+		n := min(size, len(small))
+
+		batches = append(batches, small[:n:n])
+		small = small[n:]
+	}
+
+	return batches
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBatchJobs(t *testing.T) {
+	defer func(threshold int64, size int) { BatchThreshold, MaxBatchSize = threshold, size }(BatchThreshold, MaxBatchSize)
+
+	BatchThreshold = 10
+
+	files := map[string]string{"large-a.png": strings.Repeat("x", 10), "large-b.png": strings.Repeat("x", 20)}
+
+	for i := range 20 {
+		files[fmt.Sprintf("small-%02d.png", i)] = "x"
+	}
+
+	root := writeTree(t, files)
+
+	var jobs []*Job
+
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		jobs = append(jobs, &Job{Path: filepath.Join(root, name)})
+	}
+
+	jobs = append(jobs, &Job{Path: filepath.Join(root, "missing.png")})
+
+	tests := []struct {
+		maxBatchSize int
+		workers      int
+		sizes        []int
+	}{
+		// Large and unreadable files go alone, small ones share tasks.
+		{maxBatchSize: 32, workers: 1, sizes: []int{1, 1, 1, 5, 5, 5, 5}},
+		{maxBatchSize: 4, workers: 1, sizes: []int{1, 1, 1, 4, 4, 4, 4, 4}},
+		// Several workers each get some of the small files.
+		{maxBatchSize: 32, workers: 4, sizes: slices.Repeat([]int{1}, 23)},
+		{maxBatchSize: 1, workers: 1, sizes: slices.Repeat([]int{1}, 23)},
+	}
+
+	for _, test := range tests {
+		MaxBatchSize = test.maxBatchSize
+
+		batches := BatchJobs(jobs, test.workers)
+
+		var sizes []int
+		var batched []*Job
+
+		for _, batch := range batches {
+			sizes = append(sizes, len(batch))
+			batched = append(batched, batch...)
+		}
+
+		if !slices.Equal(sizes, test.sizes) {
+			t.Errorf("max %d, %d workers: batch sizes %v, want %v", test.maxBatchSize, test.workers, sizes, test.sizes)
+		}
+
+		if len(batched) != len(jobs) {
+			t.Errorf("max %d, %d workers: %d jobs batched, want %d", test.maxBatchSize, test.workers, len(batched), len(jobs))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+var TimeBudget time.Duration
+
+const (
+	budgetMinEffort = 0
+	budgetMaxEffort = 9
+
+	// budgetSlack is how far ahead of the deadline a run must project to
+	// finish before the effort is raised again.
+	budgetSlack = 0.7
+)
+
+var budget *Budget
+
+// Budget shifts the effort of the remaining files so that a run finishes
+// within TimeBudget, judging by the throughput since the last shift.
+type Budget struct {
+	mu       sync.Mutex
+	deadline time.Time
+	left     int
+	window   int
+	since    time.Time
+	done     int
+	offset   int
+}
+
+func NewBudget(duration time.Duration, total, workers int) *Budget {
+	now := time.Now()
+
+	return &Budget{deadline: now.Add(duration), left: total, window: max(workers, 4), since: now}
+}
+
+// Params returns params with the effort shifted by the current offset. The
+// offset is relative, so per-directory efforts keep their differences.
+func (b *Budget) Params(params *vips.AvifExportParams) *vips.AvifExportParams {
+	if b == nil {
+		return params
+	}
+
+	b.mu.Lock()
+	offset := b.offset
+	b.mu.Unlock()
+
+	if offset == 0 {
+		return params
+	}
+
+	shifted := *params
+
+	shifted.Effort = min(max(params.Effort+offset, budgetMinEffort), budgetMaxEffort)
+
+	return &shifted
+}
+
+// Complete counts a finished file, and once enough files finished since the
+// last shift, lowers the effort if the run would overshoot the deadline or
+// raises it if the run is well ahead.
+func (b *Budget) Complete() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.left -= 1
+	b.done += 1
+
+	if b.done < b.window || b.left == 0 {
+		return
+	}
+
+	now := time.Now()
+	rate := float64(b.done) / now.Sub(b.since).Seconds()
+	projected := time.Duration(float64(b.left) / rate * float64(time.Second))
+	remaining := b.deadline.Sub(now)
+
+	offset := b.offset
+
+	switch {
+	case projected > remaining && AvifExportParams.Effort+offset > budgetMinEffort:
+		offset -= 1
+	case projected < time.Duration(float64(remaining)*budgetSlack) && AvifExportParams.Effort+offset < budgetMaxEffort:
+		offset += 1
+	}
+
+	if offset != b.offset {
+		b.offset = offset
+		b.done = 0
+		b.since = now
+	}
+}
+
+// Offset is the current shift of the effort.
+func (b *Budget) Offset() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.offset
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const casManifestName = "manifest.json"
+
+type CASSink struct {
+	FileSink
+
+	Dir string
+
+	mu       sync.Mutex
+	manifest map[string]string
+}
+
+func NewCASSink(dir string) (*CASSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	sink := &CASSink{Dir: dir, manifest: map[string]string{}}
+
+	data, err := os.ReadFile(filepath.Join(dir, casManifestName))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return sink, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &sink.manifest); err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// ObjectPath keeps the extension of the written path, so sidecars stored
+// next to the images are not taken for AVIF files.
+func (s *CASSink) ObjectPath(hash, ext string) string {
+	return filepath.Join(s.Dir, hash[:2], hash+ext)
+}
+
+func (s *CASSink) Write(path string, data []byte) error {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	object := s.ObjectPath(hash, filepath.Ext(path))
+
+	if _, err := os.Stat(object); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(object), 0755); err != nil {
+			return err
+		}
+
+		temp, err := os.CreateTemp(filepath.Dir(object), ".tmp-*")
+
+		if err != nil {
+			return err
+		}
+
+		err = Preallocate(temp, int64(len(data)))
+
+		if err == nil {
+			_, err = temp.Write(data)
+		}
+
+		if closeErr := temp.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err == nil {
+			err = os.Rename(temp.Name(), object)
+		}
+
+		if err != nil {
+			os.Remove(temp.Name())
+
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.manifest[path] = hash
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Object is where the output written to path is stored, if it was written.
+func (s *CASSink) Object(path string) (string, bool) {
+	s.mu.Lock()
+	hash, ok := s.manifest[path]
+	s.mu.Unlock()
+
+	if !ok {
+		return "", false
+	}
+
+	return s.ObjectPath(hash, filepath.Ext(path)), true
+}
+
+func (s *CASSink) SaveManifest() error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s.manifest, "", "  ")
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.Dir, casManifestName)
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
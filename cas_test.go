@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCASSinkManifest(t *testing.T) {
+	dir := t.TempDir()
+
+	sink, err := NewCASSink(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join("photos", "a.avif")
+
+	if err := sink.Write(output, []byte("avif")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.SaveManifest(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, casManifestName+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("temporary manifest left behind: %v", err)
+	}
+
+	reopened, err := NewCASSink(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	object, ok := reopened.Object(output)
+
+	if data, err := os.ReadFile(object); !ok || err != nil || string(data) != "avif" {
+		t.Errorf("object of %s: %s, %v, %v", output, object, ok, err)
+	}
+
+	if _, ok := reopened.Object(filepath.Join("photos", "b.avif")); ok {
+		t.Error("object of an output never written")
+	}
+}
+
+func TestManifestConvertedCAS(t *testing.T) {
+	defer func(sink Sink) { ImageSink = sink }(ImageSink)
+
+	root := writeTree(t, map[string]string{"a.png": "png"})
+
+	sink, err := NewCASSink(t.TempDir())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ImageSink = sink
+
+	manifest, err := LoadManifest(root)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := &Job{Root: root, Path: filepath.Join(root, "a.png"), Output: filepath.Join(root, "a.avif")}
+
+	if err := manifest.Record(job, &Result{Status: StatusConverted, Output: job.Output}); err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.Converted(job) {
+		t.Error("converted before the blob was written")
+	}
+
+	if err := sink.Write(job.Output, []byte("avif")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The logical output path doesn't exist, only the blob does.
+	if !manifest.Converted(job) {
+		t.Error("not converted although the blob exists")
+	}
+}
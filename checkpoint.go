@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const CheckpointName = "checkpoint"
+
+// CheckpointResultsExt names the log results are appended to as files are
+// done, next to the checkpoint holding the work list.
+const CheckpointResultsExt = ".results"
+
+var Resume = false
+
+var RunCheckpoint *Checkpoint
+
+// Checkpoint keeps the work list of a run and the results of files done so
+// far, so an interrupted run can be resumed without walking the tree again.
+type Checkpoint struct {
+	Roots   []string      `json:"roots"`
+	Entries []*QueueEntry `json:"entries"`
+
+	// Prior holds the results recorded before the run was resumed.
+	Prior []*Result `json:"-"`
+
+	path    string
+	results *os.File
+}
+
+// CheckpointPath names the checkpoint of a set of roots in the state
+// directory, so runs over different trees don't resume each other.
+func CheckpointPath(roots []string) (string, error) {
+	abs := make([]string, len(roots))
+
+	for i, root := range roots {
+		path, err := filepath.Abs(root)
+
+		if err != nil {
+			return "", err
+		}
+
+		abs[i] = path
+	}
+
+	slices.Sort(abs)
+
+	sum := sha256.Sum256([]byte(strings.Join(abs, "\n")))
+
+	return StatePath(fmt.Sprintf("%s-%x.json", CheckpointName, sum[:8]))
+}
+
+func NewCheckpoint(path string, roots []string, jobs []*Job) (*Checkpoint, error) {
+	queue := &Queue{}
+
+	if _, err := queue.Add(jobs); err != nil {
+		return nil, err
+	}
+
+	checkpoint := &Checkpoint{Roots: roots, Entries: queue.Entries, path: path}
+
+	data, err := json.Marshal(checkpoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(path + CheckpointResultsExt); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return nil, err
+	}
+
+	return checkpoint, os.Rename(tmp, path)
+}
+
+// LoadCheckpoint returns nil when there is nothing to resume. A result cut
+// short by a crash is ignored, and its file is converted again.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &Checkpoint{path: path}
+
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	file, err := os.Open(path + CheckpointResultsExt)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return checkpoint, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	scanner.Buffer(nil, 1<<20)
+
+	for scanner.Scan() {
+		result := &Result{}
+
+		if err := json.Unmarshal(scanner.Bytes(), result); err == nil {
+			checkpoint.Prior = append(checkpoint.Prior, result)
+		}
+	}
+
+	return checkpoint, scanner.Err()
+}
+
+// PendingAt returns a discovery of the files under root not done yet. They
+// go through the filters of discovery again, as files may have changed in
+// the meantime.
+func (c *Checkpoint) PendingAt(root string) (*Discovery, error) {
+	abs, err := filepath.Abs(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queue := &Queue{}
+
+	for _, entry := range c.Entries {
+		if entry.Root == abs {
+			queue.Entries = append(queue.Entries, entry)
+		}
+	}
+
+	queue.Remove(c.Prior)
+
+	admission, err := NewAdmission(root, RunObserver)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range queue.Entries {
+		if err := admission.AdmitListed(entry.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	return admission.Discovery, nil
+}
+
+func (c *Checkpoint) Open() error {
+	file, err := os.OpenFile(c.path+CheckpointResultsExt, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	c.results = file
+
+	return nil
+}
+
+// Record appends the result of a file as soon as it is done. Paths are
+// stored absolute, like the work list.
+func (c *Checkpoint) Record(result *Result) {
+	if c == nil || c.results == nil {
+		return
+	}
+
+	record := *result
+
+	if abs, err := filepath.Abs(record.Path); err == nil {
+		record.Path = abs
+	}
+
+	data, err := json.Marshal(&record)
+
+	if err != nil {
+		return
+	}
+
+	c.results.Write(append(data, '\n'))
+}
+
+// Remove deletes the checkpoint once its run has finished.
+func (c *Checkpoint) Remove() error {
+	if c.results != nil {
+		c.results.Close()
+	}
+
+	if err := os.Remove(c.path + CheckpointResultsExt); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return os.Remove(c.path)
+}
+
+// Restore counts results of the interrupted part of a run in the stats. The
+// work list tells the root of every result, which is counted under the
+// spelling of roots, the roots of the resumed run.
+func (s *Stats) Restore(checkpoint *Checkpoint, roots []string) {
+	byAbs := map[string]string{}
+
+	for _, root := range roots {
+		if abs, err := filepath.Abs(root); err == nil {
+			byAbs[abs] = root
+		}
+	}
+
+	rootOf := map[string]string{}
+
+	for _, entry := range checkpoint.Entries {
+		if root, ok := byAbs[entry.Root]; ok {
+			rootOf[entry.Path] = root
+		}
+	}
+
+	for _, result := range checkpoint.Prior {
+		s.Results = append(s.Results, result)
+
+		root, ok := rootOf[result.Path]
+
+		switch result.Status {
+		case StatusFailed:
+			s.Failed = append(s.Failed, result.Path)
+			s.Format(result.Format).Failed += 1
+
+			if ok {
+				s.Root(root).Failed += 1
+			}
+		case StatusNoGain:
+			s.NoGain = append(s.NoGain, result.Path)
+		case StatusConverted:
+			s.AddConverted(result)
+			s.Format(result.Format).Add(result)
+
+			if ok {
+				s.Root(root).Add(result)
+			}
+
+			if CheckBanding && result.Banding >= BandingThreshold {
+				s.Banding = append(s.Banding, result.Path)
+			}
+
+			if result.Protected {
+				s.Protected = append(s.Protected, result.Path)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreRoots(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	root := writeTree(t, map[string]string{"photos/a.png": "a", "photos/b.png": "b", "scans/c.png": "c"})
+	photos, scans := filepath.Join(root, "photos"), filepath.Join(root, "scans")
+
+	var jobs []*Job
+
+	for _, path := range []string{"photos/a.png", "photos/b.png", "scans/c.png"} {
+		dir, _ := filepath.Split(filepath.FromSlash(path))
+
+		jobs = append(jobs, &Job{Root: filepath.Join(root, dir), Path: filepath.Join(root, filepath.FromSlash(path))})
+	}
+
+	path, err := CheckpointPath([]string{photos, scans})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err := NewCheckpoint(path, []string{photos, scans}, jobs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkpoint.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint.Record(&Result{Path: jobs[0].Path, Format: "png", Status: StatusConverted, SizeBefore: 100, SizeAfter: 40})
+	checkpoint.Record(&Result{Path: jobs[2].Path, Format: "png", Status: StatusFailed})
+	checkpoint.results.Close()
+
+	loaded, err := LoadCheckpoint(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := &Stats{Formats: map[string]*FormatStats{}, Roots: map[string]*FormatStats{}}
+
+	stats.Restore(loaded, []string{photos + string(filepath.Separator), scans})
+
+	if got := stats.Roots[photos+string(filepath.Separator)]; got == nil || got.SizeBefore != 100 {
+		t.Errorf("restored %+v under the photos, want the converted file", got)
+	}
+
+	if got := stats.Roots[scans]; got == nil || got.Failed != 1 {
+		t.Errorf("restored %+v under the scans, want the failure", got)
+	}
+}
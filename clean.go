@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type Cleanup struct {
+	Leftovers []string
+	Empty     []string
+	Finished  []string
+	Kept      []string
+}
+
+func (c *Cleanup) Print() {
+	groups := []struct {
+		title string
+		paths []string
+	}{
+		{"Following temporary leftovers are removed:", c.Leftovers},
+		{"Following empty AVIFs are removed:", c.Empty},
+		{"Following originals are deleted to finish interrupted conversions:", c.Finished},
+		{"Following originals are kept because their AVIF is missing or empty:", c.Kept},
+	}
+
+	clean := true
+
+	for _, group := range groups {
+		if len(group.paths) == 0 {
+			continue
+		}
+
+		clean = false
+
+		fmt.Println(group.title)
+
+		for _, path := range group.paths {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+
+	if clean {
+		fmt.Println("Nothing to clean")
+	}
+}
+
+func isValidOutput(path string) bool {
+	info, err := os.Stat(path)
+
+	return err == nil && info.Mode().IsRegular() && info.Size() > 0
+}
+
+func CleanTree(root string, dryRun bool) (*Cleanup, error) {
+	cleanup := &Cleanup{}
+
+	remove := func(path string) error {
+		if dryRun {
+			return nil
+		}
+
+		return os.Remove(path)
+	}
+
+	pending, err := ReadJournal(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		name := strings.ToLower(d.Name())
+
+		switch {
+		case strings.HasSuffix(name, ".avif"+TempExt):
+			cleanup.Leftovers = append(cleanup.Leftovers, path)
+
+			return remove(path)
+		case strings.HasSuffix(name, ".avif"):
+			info, err := d.Info()
+
+			if err != nil {
+				return err
+			}
+
+			if info.Size() == 0 {
+				cleanup.Empty = append(cleanup.Empty, path)
+
+				return remove(path)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range pending {
+		if _, err := os.Lstat(entry.Path); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if !isValidOutput(entry.Output) {
+			cleanup.Kept = append(cleanup.Kept, entry.Path)
+
+			continue
+		}
+
+		if !dryRun {
+			if err := Audit(AuditDelete, entry.Path, "replacement", entry.Output, "reason", "clean"); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := remove(entry.Path); err != nil {
+			return nil, err
+		}
+
+		cleanup.Finished = append(cleanup.Finished, entry.Path)
+	}
+
+	if !dryRun {
+		if err := os.Remove(filepath.Join(root, JournalName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return cleanup, nil
+}
+
+func NewCleanCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "clean DIR",
+		Short: "Repair DIR after an interrupted run: remove leftovers and empty AVIFs, finish pending deletions",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cleanup, err := CleanTree(args[0], dryRun)
+
+			if err != nil {
+				return err
+			}
+
+			cleanup.Print()
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "only list what would be cleaned")
+
+	return cmd
+}
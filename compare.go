@@ -0,0 +1,182 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/spf13/cobra"
+)
+
+//go:embed assets/compare.html
+var compareHTML []byte
+
+type ComparePair struct {
+	Name         string `json:"name"`
+	Original     string `json:"original"`
+	AVIF         string `json:"avif"`
+	OriginalSize string `json:"original_size"`
+	AVIFSize     string `json:"avif_size"`
+}
+
+func NewComparePair(root, original, avif string) *ComparePair {
+	originalInfo, err := os.Stat(original)
+
+	if err != nil {
+		return nil
+	}
+
+	avifInfo, err := os.Stat(avif)
+
+	if err != nil {
+		return nil
+	}
+
+	name, err := filepath.Rel(root, original)
+
+	if err != nil {
+		name = original
+	}
+
+	return &ComparePair{
+		Name:         name,
+		Original:     original,
+		AVIF:         avif,
+		OriginalSize: FormatBytes(uint64(originalInfo.Size())),
+		AVIFSize:     FormatBytes(uint64(avifInfo.Size())),
+	}
+}
+
+func FindComparePairs(root string) ([]*ComparePair, error) {
+	r, err := regexp.Compile(AllowedExtensions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []*ComparePair
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() || !r.MatchString(path) {
+			return nil
+		}
+
+		if pair := NewComparePair(root, path, ReplaceExt(path)); pair != nil {
+			pairs = append(pairs, pair)
+		}
+
+		return nil
+	})
+
+	return pairs, err
+}
+
+func ComparePairsFromReport(root, path string) ([]*ComparePair, error) {
+	report, err := ReadReport(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []*ComparePair
+
+	for _, result := range report.Files {
+		if result.Status != StatusConverted || result.Output == "" {
+			continue
+		}
+
+		if pair := NewComparePair(root, result.Path, result.Output); pair != nil {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	return pairs, nil
+}
+
+func ServeCompare(addr string, pairs []*ComparePair) error {
+	allowed := map[string]bool{}
+
+	for _, pair := range pairs {
+		allowed[pair.Original] = true
+		allowed[pair.AVIF] = true
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(compareHTML)
+	})
+
+	mux.HandleFunc("/api/pairs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pairs)
+	})
+
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+
+		if !allowed[path] {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		if filepath.Ext(path) == ".avif" {
+			w.Header().Set("Content-Type", "image/avif")
+		}
+
+		http.ServeFile(w, r, path)
+	})
+
+	return http.ListenAndServe(addr, mux)
+}
+
+func NewServeCompareCmd() *cobra.Command {
+	var addr string
+	var reportPath string
+
+	cmd := &cobra.Command{
+		Use:   "serve-compare DIR",
+		Short: "Serve a local web UI comparing originals with their AVIF side by side",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var pairs []*ComparePair
+			var err error
+
+			if reportPath != "" {
+				pairs, err = ComparePairsFromReport(args[0], reportPath)
+			} else {
+				pairs, err = FindComparePairs(args[0])
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if len(pairs) == 0 {
+				fmt.Println("No original/AVIF pairs found")
+
+				return nil
+			}
+
+			fmt.Printf("Comparing %d pairs at http://%s/\n", len(pairs), addr)
+
+			return ServeCompare(addr, pairs)
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", "127.0.0.1:8080", "address to listen on")
+	cmd.Flags().StringVar(&reportPath, "report", "", "read pairs from a JSON report of a previous run instead of scanning DIR")
+
+	return cmd
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var Profile = ""
+
+var ConfigPath = ""
+
+const ConfigName = "config.toml"
+
+// Profiles are named presets of root flags. Flags given explicitly always
+// win over the profile.
+var Profiles = map[string]map[string]string{
+	"web": {
+		"small-quality":   "70",
+		"large-quality":   "55",
+		"large-threshold": "4MP",
+	},
+	"archive": {
+		"effort":          "9",
+		"target-ssim":     "0.98",
+		"check-banding":   "true",
+		"manifest-hashes": "true",
+	},
+}
+
+const (
+	SourceDefault = "default"
+	SourceFlag    = "flag"
+	SourceProfile = "profile"
+	SourceEnv     = "env"
+	SourceConfig  = "config"
+)
+
+const EnvPrefix = "AVIFY_"
+
+var flagSources = map[string]string{}
+
+func ApplyProfile(flags *pflag.FlagSet) error {
+	if Profile == "" {
+		return nil
+	}
+
+	values, ok := Profiles[Profile]
+
+	if !ok {
+		return fmt.Errorf("unknown profile %q, known profiles: %s", Profile, strings.Join(slices.Sorted(maps.Keys(Profiles)), ", "))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		flag := flags.Lookup(name)
+
+		if flag == nil || flag.Changed {
+			continue
+		}
+
+		if err := flags.Set(name, values[name]); err != nil {
+			return fmt.Errorf("profile %s: %w", Profile, err)
+		}
+
+		flagSources[name] = SourceProfile + " " + Profile
+	}
+
+	return nil
+}
+
+func EnvName(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// ApplyEnv sets flags not given on the command line from AVIFY_* variables,
+// e.g. AVIFY_LARGE_QUALITY for --large-quality. The environment wins over a
+// profile, flags win over the environment. A variable for an option in known
+// that the running command doesn't have is an error.
+func ApplyEnv(flags *pflag.FlagSet, known ...*pflag.FlagSet) error {
+	var err error
+
+	for _, set := range known {
+		set.VisitAll(func(flag *pflag.Flag) {
+			name := EnvName(flag.Name)
+
+			if _, ok := os.LookupEnv(name); ok && flags.Lookup(flag.Name) == nil && err == nil {
+				err = fmt.Errorf("%s: --%s doesn't apply to this command", name, flag.Name)
+			}
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	flags.VisitAll(func(flag *pflag.Flag) {
+		name := EnvName(flag.Name)
+		value, ok := os.LookupEnv(name)
+
+		if !ok || flag.Changed || err != nil {
+			return
+		}
+
+		if flag.Value.Type() == "bool" {
+			value = envBool(value)
+		}
+
+		if setErr := flags.Set(flag.Name, value); setErr != nil {
+			err = fmt.Errorf("%s: %w", name, setErr)
+
+			return
+		}
+
+		flagSources[flag.Name] = SourceEnv + " " + name
+	})
+
+	return err
+}
+
+// DefaultConfigPath is config.toml in the avify directory of the user
+// configuration, e.g. ~/.config/avify/config.toml.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "avify", ConfigName), nil
+}
+
+// ApplyConfig sets flags given neither on the command line nor in the
+// environment from the TOML config file. Keys are flag names, arrays set
+// repeatable flags:
+//
+//	quality = 70
+//	jobs = 4
+//	protect = ["*-edited.*", "*.psd.*"]
+//
+// Keys the running command has no option for are an error, also options of a
+// single run over DIR, like report, given to a subcommand.
+func ApplyConfig(flags *pflag.FlagSet, known ...*pflag.FlagSet) error {
+	path := ConfigPath
+
+	if path == "" {
+		var err error
+
+		if path, err = DefaultConfigPath(); err != nil {
+			return nil
+		}
+	}
+
+	file, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) && ConfigPath == "" {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	settings, err := ParseTOMLValues(file)
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		name := strings.ReplaceAll(key, "_", "-")
+		flag := flags.Lookup(name)
+
+		if flag == nil {
+			if !slices.ContainsFunc(known, func(set *pflag.FlagSet) bool { return set.Lookup(name) != nil }) {
+				return fmt.Errorf("%s: unknown option %q", path, key)
+			}
+
+			return fmt.Errorf("%s: option %q doesn't apply to this command", path, key)
+		}
+
+		if flag.Changed {
+			continue
+		}
+
+		for _, value := range settings[key] {
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+		}
+
+		flagSources[name] = SourceConfig + " " + path
+	}
+
+	return nil
+}
+
+// envBool accepts the words cron jobs and compose files tend to use for
+// switches, on top of what strconv.ParseBool knows.
+func envBool(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "y", "on":
+		return "true"
+	case "no", "n", "off", "":
+		return "false"
+	}
+
+	return value
+}
+
+func FlagSource(flag *pflag.Flag) string {
+	if source, ok := flagSources[flag.Name]; ok {
+		return source
+	}
+
+	if flag.Changed {
+		return SourceFlag
+	}
+
+	return SourceDefault
+}
+
+func flagArguments(flag *pflag.Flag) []string {
+	var values []string
+
+	if slice, ok := flag.Value.(pflag.SliceValue); ok {
+		values = slice.GetSlice()
+	} else {
+		values = []string{flag.Value.String()}
+	}
+
+	arguments := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if flag.Value.Type() == "bool" && value == "true" {
+			arguments = append(arguments, "--"+flag.Name)
+
+			continue
+		}
+
+		arguments = append(arguments, "--"+flag.Name+"="+shellQuote(value))
+	}
+
+	return arguments
+}
+
+func shellQuote(value string) string {
+	if value != "" && strings.Trim(value, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.,:/=+") == "" {
+		return value
+	}
+
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// ExplainFlags prints the effective value and origin of every flag, followed
+// by the command line that reproduces them without a profile.
+func ExplainFlags(w io.Writer, flags *pflag.FlagSet) {
+	var arguments []string
+
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == "help" || flag.Name == "profile" || flag.Name == "config" {
+			return
+		}
+
+		fmt.Fprintf(w, "%s = %s (%s)\n", flag.Name, flag.Value.String(), FlagSource(flag))
+
+		if FlagSource(flag) != SourceDefault && flag.Value.String() != flag.DefValue {
+			arguments = append(arguments, flagArguments(flag)...)
+		}
+	})
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, strings.Join(append(append([]string{"avify"}, arguments...), "DIR"), " "))
+}
+
+func NewConfigCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the effective configuration",
+	}
+
+	explain := &cobra.Command{
+		Use:   "explain",
+		Short: "Print the effective settings with their origin and the equivalent command line",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ExplainFlags(cmd.OutOrStdout(), cmd.Flags())
+
+			return nil
+		},
+	}
+
+	explain.Flags().AddFlagSet(rootFlags)
+
+	cmd.AddCommand(explain)
+
+	return cmd
+}
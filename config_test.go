@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// testFlags stands for a subcommand inheriting quality from the root, which
+// also has the run-only report.
+func testFlags() (sub, root *pflag.FlagSet) {
+	root = pflag.NewFlagSet("avify", pflag.ContinueOnError)
+	sub = pflag.NewFlagSet("watch", pflag.ContinueOnError)
+
+	root.Int("quality", 80, "")
+	root.String("report", "", "")
+	sub.Int("quality", 80, "")
+	sub.StringArray("protect", nil, "")
+
+	return sub, root
+}
+
+func TestApplyConfig(t *testing.T) {
+	defer func(path string) { ConfigPath = path }(ConfigPath)
+
+	ConfigPath = filepath.Join(t.TempDir(), ConfigName)
+
+	tests := []struct {
+		config  string
+		wantErr string
+	}{
+		{config: "quality = 70\n"},
+		{config: "quality = 70\nreport = \"report.json\"\n", wantErr: "doesn't apply"},
+		{config: "qualty = 70\n", wantErr: "unknown option"},
+		{config: "[watch]\nquality = 70\n", wantErr: "tables"},
+		{config: "quality = 70\nprotect = [\n  \"*-edited.*\",\n  \"{a,b}.*\", # both\n]\n"},
+	}
+
+	for _, test := range tests {
+		if err := os.WriteFile(ConfigPath, []byte(test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		sub, root := testFlags()
+
+		err := ApplyConfig(sub, root)
+
+		if test.wantErr == "" && err != nil || test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%q: error %v, want %q", test.config, err, test.wantErr)
+		}
+
+		if err == nil && sub.Lookup("quality").Value.String() != "70" {
+			t.Errorf("%q: quality %s, want 70", test.config, sub.Lookup("quality").Value)
+		}
+
+		if protect, _ := sub.GetStringArray("protect"); strings.Contains(test.config, "protect") && len(protect) != 2 {
+			t.Errorf("%q: protect %q, want both patterns", test.config, protect)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	sub, root := testFlags()
+
+	t.Setenv("AVIFY_QUALITY", "60")
+
+	if err := ApplyEnv(sub, root); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sub.Lookup("quality").Value.String(); got != "60" {
+		t.Errorf("quality %s, want 60", got)
+	}
+
+	t.Setenv("AVIFY_REPORT", "report.json")
+
+	if err := ApplyEnv(sub, root); err == nil || !strings.Contains(err.Error(), "AVIFY_REPORT") {
+		t.Errorf("error %v, want one about AVIFY_REPORT", err)
+	}
+}
+
+func TestEnvBool(t *testing.T) {
+	for value, want := range map[string]string{
+		"yes":   "true",
+		" On ":  "true",
+		"Y":     "true",
+		"no":    "false",
+		"OFF":   "false",
+		"":      "false",
+		"true":  "true",
+		"0":     "0",
+		"maybe": "maybe",
+	} {
+		if got := envBool(value); got != want {
+			t.Errorf("envBool(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
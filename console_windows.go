@@ -0,0 +1,27 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+const utf8CodePage = 65001
+
+func EnableConsoleANSI() bool {
+	handle := windows.Handle(os.Stdout.Fd())
+
+	var mode uint32
+
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return false
+	}
+
+	if err := windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+		return false
+	}
+
+	return windows.SetConsoleOutputCP(utf8CodePage) == nil
+}
@@ -0,0 +1,107 @@
+// Package convert turns images into AVIF in memory, for servers converting
+// uploads on the fly without touching the file system.
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+var ErrInvalidOptions = errors.New("invalid options")
+
+type Options struct {
+	// Quality is 1-100, Effort 0-9 where higher is slower and smaller.
+	Quality  int
+	Effort   int
+	Lossless bool
+
+	// StripMetadata drops EXIF, XMP and ICC data from the output.
+	StripMetadata bool
+}
+
+// DefaultOptions are the defaults of the avify command.
+var DefaultOptions = Options{Quality: 80, Effort: 5}
+
+type Result struct {
+	Format     string
+	Width      int
+	Height     int
+	SizeBefore int64
+	SizeAfter  int64
+}
+
+// Convert reads an image in any format libvips supports from r and writes it
+// to w as AVIF. libvips can't be interrupted, so ctx is only checked before
+// decoding and before writing.
+func Convert(ctx context.Context, r io.Reader, w io.Writer, opts Options) (Result, error) {
+	if opts.Quality < 1 || opts.Quality > 100 || opts.Effort < 0 || opts.Effort > 9 {
+		return Result{}, fmt.Errorf("%w: quality %d, effort %d", ErrInvalidOptions, opts.Quality, opts.Effort)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	image, err := vips.NewImageFromBuffer(data)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	defer image.Close()
+
+	result := Result{Format: formatName(image.Format()), Width: image.Width(), Height: image.Height(), SizeBefore: int64(len(data))}
+
+	output, _, err := image.ExportAvif(&vips.AvifExportParams{
+		Quality:       opts.Quality,
+		Effort:        opts.Effort,
+		Lossless:      opts.Lossless,
+		StripMetadata: opts.StripMetadata,
+	})
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	n, err := io.Copy(w, bytes.NewReader(output))
+
+	result.SizeAfter = n
+
+	return result, err
+}
+
+func formatName(format vips.ImageType) string {
+	switch format {
+	case vips.ImageTypeJPEG:
+		return "jpeg"
+	case vips.ImageTypePNG:
+		return "png"
+	case vips.ImageTypeGIF:
+		return "gif"
+	case vips.ImageTypeWEBP:
+		return "webp"
+	case vips.ImageTypeTIFF:
+		return "tiff"
+	case vips.ImageTypeHEIF:
+		return "heif"
+	case vips.ImageTypeAVIF:
+		return "avif"
+	default:
+		return "unknown"
+	}
+}
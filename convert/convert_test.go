@@ -0,0 +1,38 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConvertBeforeDecoding(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		opts Options
+		want error
+	}{
+		{name: "quality", ctx: context.Background(), opts: Options{Quality: 0, Effort: 5}, want: ErrInvalidOptions},
+		{name: "effort", ctx: context.Background(), opts: Options{Quality: 80, Effort: 10}, want: ErrInvalidOptions},
+		{name: "cancelled", ctx: cancelled, opts: DefaultOptions, want: context.Canceled},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+
+		if _, err := Convert(test.ctx, strings.NewReader("image"), &output, test.opts); !errors.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+
+		if output.Len() > 0 {
+			t.Errorf("%s: wrote %d bytes", test.name, output.Len())
+		}
+	}
+}
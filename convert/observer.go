@@ -0,0 +1,50 @@
+package convert
+
+type Phase string
+
+const (
+	PhaseDiscovery  Phase = "discovery"
+	PhaseConversion Phase = "conversion"
+	PhaseDone       Phase = "done"
+)
+
+// File is an image of a run: where it is read from and where its AVIF goes.
+type File struct {
+	Path   string
+	Output string
+}
+
+type Summary struct {
+	Converted  int
+	Skipped    int
+	Failed     int
+	SizeBefore int64
+	SizeAfter  int64
+}
+
+// Observer is notified about every file as a run goes, so embedders can render
+// their own UI. Calls for files may come from several workers, but never at
+// the same time. OnSkip gets files whose AVIF was discarded since it saved too
+// little.
+type Observer interface {
+	OnPhase(phase Phase, total int)
+	OnDiscovered(file File)
+	OnStart(file File)
+	OnComplete(file File, result Result)
+	OnSkip(file File, result Result)
+	OnError(file File, err error)
+	OnPause(reason string)
+	OnSummary(summary Summary)
+}
+
+// QuietObserver ignores everything. Embed it to implement only some calls.
+type QuietObserver struct{}
+
+func (QuietObserver) OnPhase(phase Phase, total int)      {}
+func (QuietObserver) OnDiscovered(file File)              {}
+func (QuietObserver) OnStart(file File)                   {}
+func (QuietObserver) OnComplete(file File, result Result) {}
+func (QuietObserver) OnSkip(file File, result Result)     {}
+func (QuietObserver) OnError(file File, err error)        {}
+func (QuietObserver) OnPause(reason string)               {}
+func (QuietObserver) OnSummary(summary Summary)           {}
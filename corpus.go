@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/spf13/cobra"
+)
+
+var corpusSizeBuckets = []struct {
+	limit int64
+	name  string
+}{
+	{100 << 10, "<100KB"},
+	{1 << 20, "<1MB"},
+	{5 << 20, "<5MB"},
+	{-1, ">=5MB"},
+}
+
+var corpusPixelBuckets = []struct {
+	limit int
+	name  string
+}{
+	{1e6, "<1MP"},
+	{4e6, "<4MP"},
+	{12e6, "<12MP"},
+	{-1, ">=12MP"},
+}
+
+// Stratum names the format/size/dimensions class a file belongs to.
+func Stratum(path string) (string, error) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	size := ""
+
+	for _, bucket := range corpusSizeBuckets {
+		if bucket.limit < 0 || info.Size() < bucket.limit {
+			size = bucket.name
+
+			break
+		}
+	}
+
+	pixels := "unknown"
+
+	if width, height, err := ImageDimensions(path); err == nil {
+		for _, bucket := range corpusPixelBuckets {
+			if bucket.limit < 0 || width*height < bucket.limit {
+				pixels = bucket.name
+
+				break
+			}
+		}
+	}
+
+	return fmt.Sprintf("%s %s %s", SourceFormat(path), size, pixels), nil
+}
+
+// SampleStrata picks count paths, allocating each stratum a share
+// proportional to its size but at least one file.
+func SampleStrata(strata map[string][]string, count int, seed int64) map[string][]string {
+	total := 0
+
+	for _, paths := range strata {
+		total += len(paths)
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	sample := map[string][]string{}
+
+	for _, name := range slices.Sorted(maps.Keys(strata)) {
+		paths := slices.Clone(strata[name])
+
+		slices.Sort(paths)
+
+		random.Shuffle(len(paths), func(i, j int) {
+			paths[i], paths[j] = paths[j], paths[i]
+		})
+
+		share := max(1, len(paths)*count/max(total, 1))
+
+		sample[name] = paths[:min(share, len(paths))]
+	}
+
+	return sample
+}
+
+func copyFile(source, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(source)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func NewCorpusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "corpus",
+		Short: "Build sample corpora for tuning settings",
+	}
+
+	var output string
+	var count int
+	var seed int64
+
+	build := &cobra.Command{
+		Use:   "build DIR",
+		Short: "Copy a sample of DIR stratified by format, file size and dimensions",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if count <= 0 {
+				return fmt.Errorf("invalid count %d", count)
+			}
+
+			if IsWithin(output, args[0]) {
+				return fmt.Errorf("%s must not be inside %s", output, args[0])
+			}
+
+			discovery, err := FindImagesAt(args[0])
+
+			if err != nil {
+				return err
+			}
+
+			strata := map[string][]string{}
+
+			for _, job := range discovery.Jobs {
+				name, err := Stratum(job.Path)
+
+				if err != nil {
+					return err
+				}
+
+				strata[name] = append(strata[name], job.Path)
+			}
+
+			sample := SampleStrata(strata, count, seed)
+			copied := 0
+
+			fmt.Println("Strata:")
+
+			for _, name := range slices.Sorted(maps.Keys(sample)) {
+				for _, path := range sample[name] {
+					rel, err := filepath.Rel(args[0], path)
+
+					if err != nil {
+						return err
+					}
+
+					if err := copyFile(path, filepath.Join(output, rel)); err != nil {
+						return err
+					}
+
+					copied += 1
+				}
+
+				fmt.Printf("\t%s: %d of %d\n", name, len(sample[name]), len(strata[name]))
+			}
+
+			fmt.Printf("Copied %d of %d images to %s\n", copied, len(discovery.Jobs), output)
+
+			return nil
+		},
+	}
+
+	build.Flags().StringVar(&output, "out", "", "directory to copy the sample to")
+	build.Flags().IntVar(&count, "count", 100, "approximate number of images to sample")
+	build.Flags().Int64Var(&seed, "seed", 1, "seed of the sampling, so a corpus can be rebuilt identically")
+
+	build.MarkFlagRequired("out")
+
+	cmd.AddCommand(build)
+
+	return cmd
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/demiazz/avify/convert"
+	"github.com/spf13/cobra"
+)
+
+const DaemonSocketName = "daemon.sock"
+
+const (
+	DaemonAdd    = "add"
+	DaemonStatus = "status"
+	DaemonPause  = "pause"
+	DaemonResume = "resume"
+	DaemonCancel = "cancel"
+)
+
+const (
+	DaemonIdle    = "idle"
+	DaemonRunning = "running"
+	DaemonPaused  = "paused"
+)
+
+var ErrDaemonRunning = errors.New("daemon already running")
+
+type DaemonRequest struct {
+	Command string   `json:"command"`
+	Roots   []string `json:"roots,omitempty"`
+}
+
+type DaemonState struct {
+	State     string `json:"state"`
+	Queued    int    `json:"queued"`
+	Running   int    `json:"running"`
+	Converted int    `json:"converted"`
+	Failed    int    `json:"failed"`
+}
+
+type DaemonResponse struct {
+	Error  string       `json:"error,omitempty"`
+	Added  int          `json:"added,omitempty"`
+	Status *DaemonState `json:"status,omitempty"`
+
+	// Details are the files being converted, the elapsed time and the memory
+	// usage, for the status command.
+	Details string `json:"details,omitempty"`
+}
+
+// Controller is what avify ctl and D-Bus drive: the daemon, or watch.
+type Controller interface {
+	Status() *DaemonState
+	Pause()
+	Resume()
+	Cancel()
+}
+
+// Daemon converts jobs sent over its control socket, one batch at a time,
+// keeping libvips warm between them. It observes its own runs to report
+// progress.
+type Daemon struct {
+	convert.QuietObserver
+
+	mu      sync.Mutex
+	queue   []*Job
+	running int
+	paused  bool
+	cancel  context.CancelFunc
+	wake    chan struct{}
+	state   DaemonState
+}
+
+func NewDaemon() *Daemon {
+	return &Daemon{wake: make(chan struct{}, 1)}
+}
+
+func (d *Daemon) OnComplete(file convert.File, result convert.Result) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.state.Converted += 1
+}
+
+func (d *Daemon) OnError(file convert.File, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.state.Failed += 1
+}
+
+func (d *Daemon) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Daemon) Add(roots []string) (int, error) {
+	// The daemon may run for months, so the state is pruned as it goes.
+	if err := PruneState(); err != nil {
+		fmt.Fprintf(os.Stderr, "Can't prune the state directory: %v\n", err)
+	}
+
+	var jobs []*Job
+
+	for _, root := range roots {
+		discovery, err := FindImagesAt(root)
+
+		if err != nil {
+			return 0, err
+		}
+
+		jobs = append(jobs, discovery.Jobs...)
+	}
+
+	d.mu.Lock()
+	d.queue = append(d.queue, jobs...)
+	d.mu.Unlock()
+
+	d.notify()
+
+	return len(jobs), nil
+}
+
+func (d *Daemon) Status() *DaemonState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state := d.state
+
+	state.Queued = len(d.queue)
+	state.Running = d.running
+
+	switch {
+	case d.paused:
+		state.State = DaemonPaused
+	case d.running > 0:
+		state.State = DaemonRunning
+	default:
+		state.State = DaemonIdle
+	}
+
+	return &state
+}
+
+// Pause stops the current batch after the conversions in flight, and keeps
+// the rest queued until Resume.
+func (d *Daemon) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.paused = true
+
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
+
+func (d *Daemon) Resume() {
+	d.mu.Lock()
+	d.paused = false
+	d.mu.Unlock()
+
+	d.notify()
+}
+
+// Cancel stops the current batch after the conversions in flight, and drops
+// everything queued.
+func (d *Daemon) Cancel() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.queue = nil
+
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
+
+func (d *Daemon) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		}
+
+		d.mu.Lock()
+
+		if d.paused || len(d.queue) == 0 {
+			d.mu.Unlock()
+
+			continue
+		}
+
+		jobs := d.queue
+		runCtx, cancel := context.WithCancel(ctx)
+
+		d.queue = nil
+		d.running = len(jobs)
+		d.cancel = cancel
+
+		d.mu.Unlock()
+
+		restore := ApplySchedule(time.Now())
+
+		PlanOutputs(jobs)
+
+		stats := ConvertImages(runCtx, jobs)
+
+		restore()
+		cancel()
+
+		fmt.Printf("Processed %d of %d images, %d failed\n", len(stats.Results), len(jobs), len(stats.Failed))
+
+		d.mu.Lock()
+
+		d.running = 0
+		d.cancel = nil
+
+		if d.paused {
+			processed := map[string]bool{}
+
+			for _, result := range stats.Results {
+				processed[result.Path] = true
+			}
+
+			var left []*Job
+
+			for _, job := range jobs {
+				if !processed[job.Path] {
+					left = append(left, job)
+				}
+			}
+
+			d.queue = append(left, d.queue...)
+		}
+
+		d.mu.Unlock()
+
+		d.notify()
+	}
+}
+
+func (d *Daemon) Handle(request *DaemonRequest) *DaemonResponse {
+	response := &DaemonResponse{}
+
+	switch request.Command {
+	case DaemonAdd:
+		added, err := d.Add(request.Roots)
+
+		if err != nil {
+			response.Error = err.Error()
+		}
+
+		response.Added = added
+	case DaemonPause:
+		d.Pause()
+	case DaemonResume:
+		d.Resume()
+	case DaemonCancel:
+		d.Cancel()
+	case DaemonStatus:
+		var details strings.Builder
+
+		if PrintStatus(&details) {
+			response.Details = details.String()
+		}
+	default:
+		response.Error = fmt.Sprintf("unknown command %q", request.Command)
+
+		return response
+	}
+
+	response.Status = d.Status()
+
+	return response
+}
+
+func (d *Daemon) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+
+			request := &DaemonRequest{}
+
+			if err := json.NewDecoder(conn).Decode(request); err != nil {
+				json.NewEncoder(conn).Encode(&DaemonResponse{Error: err.Error()})
+
+				return
+			}
+
+			json.NewEncoder(conn).Encode(d.Handle(request))
+		}()
+	}
+}
+
+func SendDaemon(path string, request *DaemonRequest) (*DaemonResponse, error) {
+	conn, err := dialDaemon(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return nil, err
+	}
+
+	response := &DaemonResponse{}
+
+	if err := json.NewDecoder(conn).Decode(response); err != nil {
+		return nil, err
+	}
+
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+
+	return response, nil
+}
+
+func daemonSocket(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+
+	return defaultDaemonSocket()
+}
+
+func NewDaemonCmd() *cobra.Command {
+	var socket string
+	var dbus bool
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Keep running and convert images sent with avify ctl",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := daemonSocket(socket)
+
+			if err != nil {
+				return err
+			}
+
+			listener, err := ListenDaemon(path)
+
+			if err != nil {
+				return err
+			}
+
+			defer listener.Close()
+
+			daemon := NewDaemon()
+
+			RunObserver = daemon
+
+			if dbus {
+				release, err := ExportDBus(daemon)
+
+				if err != nil {
+					return err
+				}
+
+				defer release()
+			}
+
+			ctx := cmd.Context()
+
+			go daemon.Run(ctx)
+
+			go func() {
+				<-ctx.Done()
+
+				listener.Close()
+			}()
+
+			fmt.Printf("Listening on %s\n", path)
+
+			if err := daemon.Serve(listener); ctx.Err() == nil {
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&socket, "socket", "", "path of the control socket (default in the user state directory), or of the named pipe on Windows")
+	cmd.Flags().BoolVar(&dbus, "dbus", false, "report progress and take pause, resume and cancel requests on the D-Bus session bus, Linux only")
+
+	return cmd
+}
+
+func NewCtlCmd() *cobra.Command {
+	var socket string
+
+	cmd := &cobra.Command{
+		Use:   "ctl",
+		Short: "Control a running avify daemon",
+	}
+
+	cmd.PersistentFlags().StringVar(&socket, "socket", "", "path of the control socket (default in the user state directory), or of the named pipe on Windows")
+
+	send := func(request *DaemonRequest) error {
+		path, err := daemonSocket(socket)
+
+		if err != nil {
+			return err
+		}
+
+		response, err := SendDaemon(path, request)
+
+		if err != nil {
+			return err
+		}
+
+		if request.Command == DaemonAdd {
+			fmt.Printf("Enqueued %d images\n", response.Added)
+		}
+
+		status := response.Status
+
+		fmt.Printf("%s: %d queued, %d running, %d converted, %d failed\n", status.State, status.Queued, status.Running, status.Converted, status.Failed)
+		fmt.Print(response.Details)
+
+		return nil
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add DIR...",
+		Short: "Convert images found in DIR",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			roots := make([]string, len(args))
+
+			for i, root := range args {
+				abs, err := filepath.Abs(root)
+
+				if err != nil {
+					return err
+				}
+
+				roots[i] = abs
+			}
+
+			return send(&DaemonRequest{Command: DaemonAdd, Roots: roots})
+		},
+	})
+
+	for _, command := range []struct {
+		name  string
+		short string
+	}{
+		{DaemonStatus, "Show what the daemon is doing"},
+		{DaemonPause, "Stop starting conversions until resumed"},
+		{DaemonResume, "Resume a paused daemon"},
+		{DaemonCancel, "Stop the current batch and drop queued images"},
+	} {
+		cmd.AddCommand(&cobra.Command{
+			Use:   command.name,
+			Short: command.short,
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return send(&DaemonRequest{Command: command.name})
+			},
+		})
+	}
+
+	return cmd
+}
@@ -0,0 +1,72 @@
+//go:build fake
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDaemonKeep(t *testing.T) {
+	root := writeTree(t, map[string]string{"image.png": strings.Repeat("x", 4096)})
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+	output := filepath.Join(root, "image.avif")
+	sent := false
+
+	runRoot(t, func() bool {
+		if !sent {
+			_, err := SendDaemon(socket, &DaemonRequest{Command: DaemonAdd, Roots: []string{root}})
+			sent = err == nil
+		}
+
+		_, err := os.Stat(output)
+
+		return err == nil
+	}, "daemon", "--socket", socket, "--keep", "--quality", "60")
+
+	if _, err := os.Stat(output); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "image.png")); err != nil {
+		t.Errorf("original removed despite --keep: %v", err)
+	}
+}
+
+func TestQueueRunOutput(t *testing.T) {
+	root := writeTree(t, map[string]string{"nested/image.png": strings.Repeat("x", 4096)})
+	queue := filepath.Join(t.TempDir(), "queue.json")
+	output := t.TempDir()
+
+	runRoot(t, nil, "queue", "add", "--queue", queue, root)
+	runRoot(t, nil, "queue", "run", "--queue", queue, "--output", output)
+
+	if _, err := os.Stat(filepath.Join(output, "nested", "image.avif")); err != nil {
+		t.Errorf("no output in --output: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "nested", "image.png")); err != nil {
+		t.Errorf("original removed with --output: %v", err)
+	}
+}
+
+func TestDaemonStatusDetails(t *testing.T) {
+	daemon := NewDaemon()
+
+	if details := daemon.Handle(&DaemonRequest{Command: DaemonStatus}).Details; details != "" {
+		t.Errorf("details while idle: %q", details)
+	}
+
+	job := &Job{Path: filepath.Join("photos", "a.png")}
+
+	defer ReportStatus(func() *RunStatus {
+		return &RunStatus{Started: time.Now(), Total: 2, Workers: 1, Running: map[*Job]time.Time{job: time.Now()}}
+	})()
+
+	if details := daemon.Handle(&DaemonRequest{Command: DaemonStatus}).Details; !strings.Contains(details, job.Path) {
+		t.Errorf("details %q don't list %s", details, job.Path)
+	}
+}
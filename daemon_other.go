@@ -0,0 +1,52 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+)
+
+func defaultDaemonSocket() (string, error) {
+	return StatePath(DaemonSocketName)
+}
+
+// ListenDaemon takes over a socket left behind by a crashed daemon, but
+// refuses to start a second one. Whoever can connect can make the daemon
+// convert and delete files, so only the user running it may.
+func ListenDaemon(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := dialDaemon(path); err == nil {
+			conn.Close()
+
+			return nil, fmt.Errorf("%s: %w", path, ErrDaemonRunning)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+func dialDaemon(path string) (net.Conn, error) {
+	return net.Dial("unix", path)
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenDaemonPrivate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daemon.sock")
+
+	listener, err := ListenDaemon(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("socket mode %v, want %v", mode, os.FileMode(0600))
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// The daemon listens on a named pipe, which only SYSTEM and the user who
+// started the daemon may open.
+const daemonPipeSecurity = "D:P(A;;GA;;;SY)(A;;GA;;;OW)"
+
+const daemonDialTimeout = 2 * time.Second
+
+func defaultDaemonSocket() (string, error) {
+	user := strings.ReplaceAll(os.Getenv("USERNAME"), `\`, "-")
+
+	return `\\.\pipe\avify-` + user, nil
+}
+
+// ListenDaemon refuses to start a second daemon. Named pipes go away with
+// the process serving them, so there is nothing left behind to take over.
+func ListenDaemon(path string) (net.Listener, error) {
+	if conn, err := dialDaemon(path); err == nil {
+		conn.Close()
+
+		return nil, fmt.Errorf("%s: %w", path, ErrDaemonRunning)
+	}
+
+	return winio.ListenPipe(path, &winio.PipeConfig{SecurityDescriptor: daemonPipeSecurity})
+}
+
+func dialDaemon(path string) (net.Conn, error) {
+	timeout := daemonDialTimeout
+
+	return winio.DialPipe(path, &timeout)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+const (
+	DBusName      = "io.github.demiazz.Avify"
+	DBusPath      = dbus.ObjectPath("/io/github/demiazz/Avify")
+	DBusInterface = "io.github.demiazz.Avify1"
+)
+
+const dbusIntrospection = `<node>
+	<interface name="` + DBusInterface + `">
+		<method name="Status">
+			<arg name="state" direction="out" type="s"/>
+			<arg name="queued" direction="out" type="u"/>
+			<arg name="running" direction="out" type="u"/>
+			<arg name="converted" direction="out" type="u"/>
+			<arg name="failed" direction="out" type="u"/>
+		</method>
+		<method name="Pause"/>
+		<method name="Resume"/>
+		<method name="Cancel"/>
+		<signal name="StatusChanged">
+			<arg name="state" type="s"/>
+			<arg name="queued" type="u"/>
+			<arg name="running" type="u"/>
+			<arg name="converted" type="u"/>
+			<arg name="failed" type="u"/>
+		</signal>
+	</interface>` + introspect.IntrospectDataString + `</node>`
+
+// dbusStatusInterval is how often the status is checked for StatusChanged.
+const dbusStatusInterval = time.Second
+
+type dbusObject struct {
+	controller Controller
+}
+
+func (o dbusObject) Status() (string, uint32, uint32, uint32, uint32, *dbus.Error) {
+	state := o.controller.Status()
+
+	return state.State, uint32(state.Queued), uint32(state.Running), uint32(state.Converted), uint32(state.Failed), nil
+}
+
+func (o dbusObject) Pause() *dbus.Error {
+	o.controller.Pause()
+
+	return nil
+}
+
+func (o dbusObject) Resume() *dbus.Error {
+	o.controller.Resume()
+
+	return nil
+}
+
+func (o dbusObject) Cancel() *dbus.Error {
+	o.controller.Cancel()
+
+	return nil
+}
+
+// ExportDBus makes controller available on the session bus, so desktop
+// environments can show the progress and pause or cancel the conversions.
+// The returned function releases the name.
+func ExportDBus(controller Controller) (func(), error) {
+	conn, err := dbus.ConnectSessionBus()
+
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.RequestName(DBusName, dbus.NameFlagDoNotQueue)
+
+	if err == nil && reply != dbus.RequestNameReplyPrimaryOwner {
+		err = fmt.Errorf("%s is taken, another avify is running", DBusName)
+	}
+
+	if err == nil {
+		err = conn.Export(dbusObject{controller}, DBusPath, DBusInterface)
+	}
+
+	if err == nil {
+		err = conn.Export(introspect.Introspectable(dbusIntrospection), DBusPath, "org.freedesktop.DBus.Introspectable")
+	}
+
+	if err != nil {
+		conn.Close()
+
+		return nil, err
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(dbusStatusInterval)
+
+		defer ticker.Stop()
+
+		var last DaemonState
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			if state := controller.Status(); *state != last {
+				last = *state
+
+				conn.Emit(DBusPath, DBusInterface+".StatusChanged", state.State, uint32(state.Queued), uint32(state.Running), uint32(state.Converted), uint32(state.Failed))
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		conn.Close()
+	}, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+var ErrNoDBus = errors.New("D-Bus is only supported on Linux")
+
+func ExportDBus(controller Controller) (func(), error) {
+	return nil, ErrNoDBus
+}
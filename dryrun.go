@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+var DryRun = false
+
+func PrintDryRun(jobs []*Job) {
+	var total uint64
+
+	fmt.Println("Would convert:")
+
+	for _, job := range jobs {
+		if job.Error != nil {
+			fmt.Printf("\t%s: %v\n", job.Path, job.Error)
+
+			continue
+		}
+
+		info, err := os.Stat(job.Path)
+
+		if err != nil {
+			fmt.Printf("\t%s: %v\n", job.Path, err)
+
+			continue
+		}
+
+		total += uint64(info.Size())
+
+		if job.Output == "" {
+			fmt.Printf("\t%s (%s)\n", job.Path, FormatBytes(uint64(info.Size())))
+
+			continue
+		}
+
+		fmt.Printf("\t%s -> %s (%s)\n", job.Path, job.Output, FormatBytes(uint64(info.Size())))
+	}
+
+	fmt.Printf("%d files, %s in total\n", len(jobs), FormatBytes(total))
+}
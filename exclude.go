@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ExcludePatterns []string
+
+func CheckExcludes(patterns []string) error {
+	for _, pattern := range patterns {
+		for _, segment := range strings.Split(pattern, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsExcluded matches the path relative to the root against --exclude
+// patterns. Patterns without a slash match the name alone, others the whole
+// relative path, where ** stands for any number of directories.
+func IsExcluded(root, p string) bool {
+	if len(ExcludePatterns) == 0 {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, p)
+
+	if err != nil || rel == "." {
+		return false
+	}
+
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+
+	for _, pattern := range ExcludePatterns {
+		if !strings.Contains(pattern, "/") {
+			if matched, _ := path.Match(pattern, segments[len(segments)-1]); matched {
+				return true
+			}
+
+			continue
+		}
+
+		if matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), segments) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
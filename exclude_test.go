@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"a/b.png", "a/b.png", true},
+		{"a/*.png", "a/b.png", true},
+		{"a/*.png", "a/c/b.png", false},
+		{"**/b.png", "b.png", true},
+		{"**/b.png", "a/c/b.png", true},
+		{"a/**", "a", true},
+		{"a/**", "a/c/b.png", true},
+		{"a/**/b.png", "a/b.png", true},
+		{"a/**/b.png", "a/c/d/b.png", true},
+		{"a/**/b.png", "x/c/b.png", false},
+		{"a", "a/b.png", false},
+	}
+
+	for _, test := range tests {
+		if got := matchSegments(strings.Split(test.pattern, "/"), strings.Split(test.path, "/")); got != test.want {
+			t.Errorf("%s against %s: %v, want %v", test.pattern, test.path, got, test.want)
+		}
+	}
+}
+
+func TestIsExcluded(t *testing.T) {
+	defer func(saved []string) { ExcludePatterns = saved }(ExcludePatterns)
+
+	root := filepath.FromSlash("/photos")
+
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{nil, "a/b.png", false},
+		{[]string{"*.png"}, "a/b.png", true},
+		{[]string{"*.png"}, "a/b.jpg", false},
+		{[]string{"drafts"}, "drafts", true},
+		{[]string{"drafts/*"}, "drafts/b.png", true},
+		{[]string{"/drafts/"}, "drafts", true},
+		{[]string{"drafts/*"}, "a/drafts/b.png", false},
+		{[]string{"**/drafts/**"}, "a/drafts/c/b.png", true},
+		{[]string{"*"}, ".", false},
+	}
+
+	for _, test := range tests {
+		ExcludePatterns = test.patterns
+
+		if got := IsExcluded(root, filepath.Join(root, filepath.FromSlash(test.path))); got != test.want {
+			t.Errorf("%q against %s: %v, want %v", test.patterns, test.path, got, test.want)
+		}
+	}
+}
+
+func TestCheckExcludes(t *testing.T) {
+	if err := CheckExcludes([]string{"*.png", "a/**/b"}); err != nil {
+		t.Errorf("valid patterns: %v", err)
+	}
+
+	if err := CheckExcludes([]string{"a/[b"}); err == nil {
+		t.Error("a/[b: no error")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+func ExifValue(exif map[string]string, name string) string {
+	for key, value := range exif {
+		if !strings.HasSuffix(key, "-"+name) {
+			continue
+		}
+
+		if i := strings.Index(value, " ("); i >= 0 {
+			value = value[:i]
+		}
+
+		return strings.TrimSpace(value)
+	}
+
+	return ""
+}
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+func ExifCaptureTime(image Image) (time.Time, bool) {
+	ref, ok := image.(*vips.ImageRef)
+
+	if !ok {
+		return time.Time{}, false
+	}
+
+	exif := ref.GetExif()
+
+	for _, name := range []string{"DateTimeOriginal", "DateTimeDigitized", "DateTime"} {
+		value := ExifValue(exif, name)
+
+		if len(value) < len(exifTimeLayout) {
+			continue
+		}
+
+		if t, err := time.ParseInLocation(exifTimeLayout, value[:len(exifTimeLayout)], time.Local); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func CaptureTime(image Image, path string) time.Time {
+	if t, ok := ExifCaptureTime(image); ok {
+		return t
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		return info.ModTime()
+	}
+
+	return time.Now()
+}
+
+// CameraModel names the camera from EXIF, e.g. "Canon EOS R5". Models that
+// already start with the make are kept as they are.
+func CameraModel(image Image) string {
+	ref, ok := image.(*vips.ImageRef)
+
+	if !ok {
+		return ""
+	}
+
+	exif := ref.GetExif()
+	maker := ExifValue(exif, "Make")
+	model := ExifValue(exif, "Model")
+
+	if maker == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(strings.Fields(maker)[0])) {
+		return model
+	}
+
+	return strings.TrimSpace(maker + " " + model)
+}
+
+const ExifSidecarExt = ".exif"
+
+var ExifSidecar = false
+
+// MakerNoteExif returns the complete EXIF block of images carrying vendor
+// MakerNotes, which often do not survive being copied into AVIF intact.
+func MakerNoteExif(image Image) []byte {
+	ref, ok := image.(*vips.ImageRef)
+
+	if !ok {
+		return nil
+	}
+
+	for key := range ref.GetExif() {
+		if strings.HasSuffix(key, "-MakerNote") {
+			return ref.GetBlob("exif-data")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const FailureLogName = ".avify-failures.log"
+
+var FailureLogPath = ""
+
+var (
+	failureMu   sync.Mutex
+	failureFile *os.File
+	failureErr  error
+)
+
+// ResetFailureLog removes the log of the previous run, so the log only ever
+// lists the failures of one run. A resumed run keeps the log it continues.
+func ResetFailureLog() error {
+	if FailureLogPath == "" {
+		return nil
+	}
+
+	if err := os.Remove(FailureLogPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// LogFailure appends a line to the failure log as soon as a file fails, so the
+// list survives a crash. The log is created on the first failure only.
+func LogFailure(path string, err error) {
+	if FailureLogPath == "" {
+		return
+	}
+
+	failureMu.Lock()
+	defer failureMu.Unlock()
+
+	if failureFile == nil && failureErr == nil {
+		failureFile, failureErr = os.OpenFile(FailureLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+
+		if failureErr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open failure log: %v\n", failureErr)
+		}
+	}
+
+	if failureFile == nil {
+		return
+	}
+
+	_, writeErr := fmt.Fprintf(failureFile, "%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), RunID, strconv.Quote(path), strconv.Quote(err.Error()))
+
+	if writeErr == nil {
+		writeErr = failureFile.Sync()
+	}
+
+	// Reported once, the log is given up on rather than left half-written.
+	if writeErr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write failure log: %v\n", writeErr)
+
+		failureFile.Close()
+		failureFile, failureErr = nil, writeErr
+	}
+}
+
+func CloseFailureLog() {
+	failureMu.Lock()
+	defer failureMu.Unlock()
+
+	if failureFile != nil {
+		failureFile.Close()
+		failureFile = nil
+	}
+}
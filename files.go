@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// filesPerJob is how many files a conversion may hold open at once: the
+// source, the temporary output, libvips temporaries and sidecars.
+const filesPerJob = 16
+
+// reservedFiles are kept for everything else: logs, the checkpoint,
+// manifests, sockets and the standard streams.
+const reservedFiles = 64
+
+// LimitConcurrency lowers the number of parallel conversions, and how far
+// SIGUSR2 can raise it, to what the open files limit allows, so restrictive
+// systems don't fail with "too many open files" in the middle of a batch.
+func LimitConcurrency() error {
+	limit, err := FileLimit()
+
+	if err != nil || limit == 0 {
+		return err
+	}
+
+	allowed := 1
+
+	if limit > reservedFiles+filesPerJob {
+		allowed = int(min((limit-reservedFiles)/filesPerJob, uint64(MaxConcurrency)))
+	}
+
+	MaxConcurrency = min(MaxConcurrency, allowed)
+
+	if Concurrency > allowed {
+		fmt.Fprintf(os.Stderr, "Only %d files may be open at once, converting %d images in parallel instead of %d\n", limit, allowed, Concurrency)
+
+		Concurrency = allowed
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	FilesFrom  = ""
+	FilesFrom0 = ""
+)
+
+// ReadFileList reads paths terminated by sep from path, or from stdin for -.
+// With a NUL separator paths are taken as they are, newlines included.
+func ReadFileList(path string, sep byte) ([]string, error) {
+	var r io.Reader = os.Stdin
+
+	if path != "-" {
+		file, err := os.Open(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer file.Close()
+
+		r = file
+	}
+
+	var paths []string
+
+	scanner := bufio.NewScanner(r)
+
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+
+		return 0, nil, nil
+	})
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if sep == '\n' {
+			line = strings.TrimRight(line, "\r")
+		}
+
+		if line != "" {
+			paths = append(paths, filepath.Clean(line))
+		}
+	}
+
+	return paths, scanner.Err()
+}
+
+// FindListedImagesAt builds the work list of root from the listed paths
+// under it, instead of walking the tree. The listed files still go through
+// the filters of discovery.
+func FindListedImagesAt(root string, paths []string) (*Discovery, error) {
+	admission, err := NewAdmission(root, RunObserver)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		// Paths under none of the roots are recorded by the caller.
+		if !IsWithin(path, root) {
+			continue
+		}
+
+		if err := admission.AdmitListed(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return admission.Discovery, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var FromReport = ""
+
+var ReportSubsets = []string{SubsetFailed}
+
+const (
+	SubsetFailed    = "failed"
+	SubsetLarger    = "larger"
+	SubsetBanding   = "banding"
+	SubsetProtected = "protected"
+	SubsetNoGain    = "no-gain"
+)
+
+var ErrUnknownSubset = errors.New("unknown report subset")
+
+func InSubset(result *Result, subset string) (bool, error) {
+	switch subset {
+	case SubsetFailed:
+		return result.Status == StatusFailed, nil
+	case SubsetLarger:
+		return result.Status == StatusConverted && result.SizeAfter >= result.SizeBefore, nil
+	case SubsetBanding:
+		return result.Banding > 0 && result.Banding >= BandingThreshold, nil
+	case SubsetProtected:
+		return result.Protected, nil
+	case SubsetNoGain:
+		return result.Status == StatusNoGain, nil
+	}
+
+	return false, fmt.Errorf("%w %q", ErrUnknownSubset, subset)
+}
+
+// FindReportedImagesAt builds the work list of root from the files of a
+// previous report in any of the subsets, instead of walking the tree. The
+// files still go through the filters of discovery.
+func FindReportedImagesAt(root string, report *Report, subsets []string) (*Discovery, error) {
+	for _, subset := range subsets {
+		if _, err := InSubset(&Result{}, subset); err != nil {
+			return nil, err
+		}
+	}
+
+	admission, err := NewAdmission(root, RunObserver)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range report.Files {
+		// Paths under none of the roots are recorded by the caller.
+		if !IsWithin(result.Path, root) {
+			continue
+		}
+
+		selected := false
+
+		for _, subset := range subsets {
+			in, _ := InSubset(result, subset)
+
+			selected = selected || in
+		}
+
+		if !selected {
+			admission.Discovery.Skip(SkipNotInReport, result.Path)
+
+			continue
+		}
+
+		if err := admission.AdmitListed(result.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	return admission.Discovery, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// rootGlobs holds the patterns files under a root given as a glob must
+// match. Roots given as plain directories have none.
+var rootGlobs = map[string][][]string{}
+
+func HasGlobMeta(arg string) bool {
+	return strings.ContainsAny(arg, "*?[")
+}
+
+// ExpandGlobs replaces glob arguments like photos/2023/**/*.png by the
+// directory before their first wildcard, so they work without a shell that
+// expands them. Discovery then keeps the files matching the rest.
+func ExpandGlobs(args []string) ([]string, error) {
+	rootGlobs = map[string][][]string{}
+
+	var roots []string
+
+	plain := map[string]bool{}
+
+	for _, arg := range args {
+		root := arg
+
+		if HasGlobMeta(arg) {
+			segments := strings.Split(filepath.ToSlash(arg), "/")
+			i := slices.IndexFunc(segments, HasGlobMeta)
+
+			switch {
+			case i == 0:
+				root = "."
+			case i == 1 && segments[0] == "":
+				root = string(filepath.Separator)
+			default:
+				root = filepath.FromSlash(strings.Join(segments[:i], "/"))
+			}
+
+			for _, segment := range segments[i:] {
+				if _, err := path.Match(segment, ""); err != nil {
+					return nil, fmt.Errorf("invalid glob %q: %w", arg, err)
+				}
+			}
+
+			rootGlobs[root] = append(rootGlobs[root], segments[i:])
+		} else {
+			plain[root] = true
+		}
+
+		if !slices.Contains(roots, root) {
+			roots = append(roots, root)
+		}
+	}
+
+	for root := range plain {
+		delete(rootGlobs, root)
+	}
+
+	return roots, nil
+}
+
+func MatchesGlobs(root, p string) bool {
+	patterns, ok := rootGlobs[root]
+
+	if !ok {
+		return true
+	}
+
+	rel, err := filepath.Rel(root, p)
+
+	if err != nil {
+		return false
+	}
+
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+
+	for _, pattern := range patterns {
+		if matchSegments(pattern, segments) {
+			return true
+		}
+	}
+
+	return false
+}
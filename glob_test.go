@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExpandGlobs(t *testing.T) {
+	defer func(saved map[string][][]string) { rootGlobs = saved }(rootGlobs)
+
+	tests := []struct {
+		args  []string
+		roots []string
+		globs map[string]int
+	}{
+		{args: []string{"photos"}, roots: []string{"photos"}, globs: map[string]int{}},
+		{args: []string{"photos/2023/**/*.png"}, roots: []string{"photos/2023"}, globs: map[string]int{"photos/2023": 1}},
+		{args: []string{"*.png"}, roots: []string{"."}, globs: map[string]int{".": 1}},
+		{args: []string{"/*/a.png"}, roots: []string{"/"}, globs: map[string]int{"/": 1}},
+		{args: []string{"photos/*.png", "photos/*.jpg"}, roots: []string{"photos"}, globs: map[string]int{"photos": 2}},
+		// A plain root converts everything under it, globs for it or not.
+		{args: []string{"photos/*.png", "photos"}, roots: []string{"photos"}, globs: map[string]int{}},
+	}
+
+	for _, test := range tests {
+		roots, err := ExpandGlobs(test.args)
+
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+
+			continue
+		}
+
+		want := make([]string, len(test.roots))
+
+		for i, root := range test.roots {
+			want[i] = filepath.FromSlash(root)
+		}
+
+		if !slices.Equal(roots, want) {
+			t.Errorf("%q: roots %q, want %q", test.args, roots, want)
+		}
+
+		if len(rootGlobs) != len(test.globs) {
+			t.Errorf("%q: globs %q, want %v", test.args, rootGlobs, test.globs)
+		}
+
+		for root, count := range test.globs {
+			if got := len(rootGlobs[filepath.FromSlash(root)]); got != count {
+				t.Errorf("%q: %d globs for %s, want %d", test.args, got, root, count)
+			}
+		}
+	}
+
+	if _, err := ExpandGlobs([]string{"photos/[a.png"}); err == nil {
+		t.Error("photos/[a.png: no error")
+	}
+}
+
+func TestMatchesGlobs(t *testing.T) {
+	defer func(saved map[string][][]string) { rootGlobs = saved }(rootGlobs)
+
+	if _, err := ExpandGlobs([]string{"photos/**/*.png", "scans"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		root, path string
+		want       bool
+	}{
+		{"photos", "photos/a.png", true},
+		{"photos", "photos/2023/a.png", true},
+		{"photos", "photos/a.jpg", false},
+		{"scans", "scans/a.jpg", true},
+	}
+
+	for _, test := range tests {
+		if got := MatchesGlobs(filepath.FromSlash(test.root), filepath.FromSlash(test.path)); got != test.want {
+			t.Errorf("%s: %v, want %v", test.path, got, test.want)
+		}
+	}
+}
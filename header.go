@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+)
+
+var ErrUnknownHeader = errors.New("unrecognized image header")
+
+// ImageDimensions reads the dimensions from the image header only, without
+// decoding pixels or starting libvips.
+func ImageDimensions(path string) (int, int, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer file.Close()
+
+	head := make([]byte, 30)
+
+	n, _ := io.ReadFull(file, head)
+	head = head[:n]
+
+	if len(head) >= 30 && bytes.HasPrefix(head, riffMagic) && bytes.Equal(head[8:12], webpMagic) {
+		return webpDimensions(head)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+
+	config, _, err := image.DecodeConfig(file)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return config.Width, config.Height, nil
+}
+
+func webpDimensions(head []byte) (int, int, error) {
+	chunk := head[12:30]
+
+	switch string(chunk[0:4]) {
+	case "VP8 ":
+		if chunk[11] != 0x9d || chunk[12] != 0x01 || chunk[13] != 0x2a {
+			return 0, 0, ErrUnknownHeader
+		}
+
+		width := int(binary.LittleEndian.Uint16(chunk[14:16]) & 0x3fff)
+		height := int(binary.LittleEndian.Uint16(chunk[16:18]) & 0x3fff)
+
+		return width, height, nil
+	case "VP8L":
+		if chunk[8] != 0x2f {
+			return 0, 0, ErrUnknownHeader
+		}
+
+		bits := binary.LittleEndian.Uint32(chunk[9:13])
+
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, nil
+	case "VP8X":
+		width := int(chunk[12]) | int(chunk[13])<<8 | int(chunk[14])<<16
+		height := int(chunk[15]) | int(chunk[16])<<8 | int(chunk[17])<<16
+
+		return width + 1, height + 1, nil
+	}
+
+	return 0, 0, ErrUnknownHeader
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+)
+
+const (
+	HEICSkip      = "skip"
+	HEICRepackage = "repackage"
+	HEICConvert   = "convert"
+)
+
+var HEICPolicy = HEICSkip
+
+var ErrNotAV1 = errors.New("primary image is not AV1 coded")
+
+// HEIFCoding reads the coding of the primary image from the start of the
+// file, falling back to the whole file when the meta box is further away.
+// It runs during discovery, out of reach of the recovery of conversions, so
+// a panic on a corrupt file is turned into an error, and the file skipped.
+func HEIFCoding(path string) (kind string, err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			kind, err = "", &PanicError{Value: value, Stack: debug.Stack()}
+		}
+	}()
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	head := make([]byte, 64*1024)
+
+	n, err := io.ReadFull(file, head)
+
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+
+	if kind, err := PrimaryItemType(head[:n]); err == nil {
+		return kind, nil
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	return PrimaryItemType(data)
+}
+
+func IsHEIF(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".heic", ".heif", ".hif":
+		return true
+	}
+
+	return false
+}
+
+// PrimaryItemType reads the coding of the primary image of a HEIF file, e.g.
+// hvc1 for HEVC as written by iPhones or av01 for AV1.
+func PrimaryItemType(data []byte) (string, error) {
+	boxes, err := ParseBoxes(data)
+
+	if err != nil && len(boxes) == 0 {
+		return "", err
+	}
+
+	var meta *Box
+
+	for _, box := range boxes {
+		if box.Type == "meta" {
+			meta = box
+		}
+	}
+
+	if meta == nil {
+		return "", ErrMalformedBox
+	}
+
+	primary := uint32(0)
+	types := map[uint32]string{}
+
+	for _, box := range meta.Children {
+		switch box.Type {
+		case "pitm":
+			if len(box.Payload) > 4 {
+				primary = readItemID(box.Payload, 4, box.Payload[0] > 0)
+			}
+		case "iinf":
+			for _, infe := range box.Children {
+				if infe.Type != "infe" || len(infe.Payload) < 4 || infe.Payload[0] < 2 {
+					continue
+				}
+
+				wide := infe.Payload[0] > 2
+				id := readItemID(infe.Payload, 4, wide)
+				offset := 4 + 2 + 2
+
+				if wide {
+					offset = 4 + 4 + 2
+				}
+
+				if len(infe.Payload) >= offset+4 {
+					types[id] = string(infe.Payload[offset : offset+4])
+				}
+			}
+		}
+	}
+
+	kind, ok := types[primary]
+
+	if !ok {
+		return "", ErrMalformedBox
+	}
+
+	return kind, nil
+}
+
+// readItemID reads a 16-bit item ID, or a 32-bit one for box versions that
+// use them.
+func readItemID(payload []byte, offset int, wide bool) uint32 {
+	if wide && len(payload) >= offset+4 {
+		return binary.BigEndian.Uint32(payload[offset:])
+	}
+
+	if len(payload) >= offset+2 {
+		return uint32(binary.BigEndian.Uint16(payload[offset:]))
+	}
+
+	return 0
+}
+
+// RepackageHEIF turns an AV1 coded HEIF into an AVIF without decoding it:
+// the bitstream stays as is and only the container brand changes.
+func RepackageHEIF(job *Job) (*Result, error) {
+	path := job.Path
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	kind, err := PrimaryItemType(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if kind != "av01" {
+		return nil, ErrNotAV1
+	}
+
+	brand := AvifBrand
+
+	if brand == "" {
+		brand = "avif"
+	}
+
+	if err := SetMajorBrand(data, brand); err != nil {
+		return nil, err
+	}
+
+	result := &Result{Path: path, Output: OutputPath(job, nil), Format: SourceFormat(path), Protected: IsProtected(path, nil)}
+
+	result.SizeBefore = uint64(len(data))
+	result.SizeAfter = uint64(len(data))
+
+	if err := job.Commit(); err != nil {
+		return nil, err
+	}
+
+	if err := ImageSink.Write(result.Output, data); err != nil {
+		return nil, err
+	}
+
+	if !KeepOriginals && !result.Protected {
+		if err := ReplaceOriginal(job, result.Output, int64(len(data))); err != nil {
+			return nil, err
+		}
+
+		result.Replaced = true
+	}
+
+	return result, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRepackageSkipsCorruptHEIC(t *testing.T) {
+	defer func(policy string) { HEICPolicy = policy }(HEICPolicy)
+
+	HEICPolicy = HEICRepackage
+
+	image, err := os.ReadFile(filepath.Join("testdata", "complete.png"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := append(box("ftyp", 16, 0, []byte("heicmif1")), box("meta", 1, 0x7ffffffffffffff8, make([]byte, 16))...)
+
+	root := writeTree(t, map[string]string{"a.png": string(image), "corrupt.heic": string(corrupt)})
+
+	discovery, err := FindImagesAt(root)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := jobPaths(discovery), []string{filepath.Join(root, "a.png")}; !slices.Equal(got, want) {
+		t.Errorf("found %v, want %v", got, want)
+	}
+
+	if discovery.Skipped[SkipHEVC] != 1 {
+		t.Errorf("skipped %v, want the corrupt HEIC", discovery.Skipped)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+var DiscoveryStats = false
+
+const (
+	OrientationLandscape = "landscape"
+	OrientationPortrait  = "portrait"
+	OrientationSquare    = "square"
+)
+
+type SizeBucket struct {
+	Label string
+	Below int
+}
+
+var SizeBuckets = []SizeBucket{
+	{"< 1MP", 1_000_000},
+	{"1-4MP", 4_000_000},
+	{"4-8MP", 8_000_000},
+	{"8-16MP", 16_000_000},
+	{"16-32MP", 32_000_000},
+	{">= 32MP", 0},
+}
+
+// Histogram describes what discovery found, based on image headers only.
+type Histogram struct {
+	Formats     map[string]int `json:"formats"`
+	Sizes       map[string]int `json:"sizes"`
+	Orientation map[string]int `json:"orientation"`
+	Unreadable  int            `json:"unreadable,omitempty"`
+	MaxWidth    int            `json:"max_width"`
+	MaxHeight   int            `json:"max_height"`
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{Formats: map[string]int{}, Sizes: map[string]int{}, Orientation: map[string]int{}}
+}
+
+func (h *Histogram) Add(path string) {
+	h.Formats[SourceFormat(path)] += 1
+
+	width, height, err := ImageDimensions(path)
+
+	if err != nil {
+		h.Unreadable += 1
+
+		return
+	}
+
+	pixels := width * height
+
+	for _, bucket := range SizeBuckets {
+		if bucket.Below == 0 || pixels < bucket.Below {
+			h.Sizes[bucket.Label] += 1
+
+			break
+		}
+	}
+
+	switch {
+	case width > height:
+		h.Orientation[OrientationLandscape] += 1
+	case width < height:
+		h.Orientation[OrientationPortrait] += 1
+	default:
+		h.Orientation[OrientationSquare] += 1
+	}
+
+	h.MaxWidth = max(h.MaxWidth, width)
+	h.MaxHeight = max(h.MaxHeight, height)
+}
+
+func (h *Histogram) Merge(other *Histogram) {
+	for format, count := range other.Formats {
+		h.Formats[format] += count
+	}
+
+	for size, count := range other.Sizes {
+		h.Sizes[size] += count
+	}
+
+	for orientation, count := range other.Orientation {
+		h.Orientation[orientation] += count
+	}
+
+	h.Unreadable += other.Unreadable
+	h.MaxWidth = max(h.MaxWidth, other.MaxWidth)
+	h.MaxHeight = max(h.MaxHeight, other.MaxHeight)
+}
+
+func (h *Histogram) Print() {
+	fmt.Println("Found:")
+
+	for _, format := range slices.Sorted(maps.Keys(h.Formats)) {
+		fmt.Printf("\t%s: %d\n", format, h.Formats[format])
+	}
+
+	fmt.Println("By size:")
+
+	for _, bucket := range SizeBuckets {
+		if count := h.Sizes[bucket.Label]; count > 0 {
+			fmt.Printf("\t%s: %d\n", bucket.Label, count)
+		}
+	}
+
+	fmt.Printf("\tmax dimensions: %dx%d\n", h.MaxWidth, h.MaxHeight)
+
+	if h.Unreadable > 0 {
+		fmt.Printf("\tunreadable header: %d\n", h.Unreadable)
+	}
+
+	fmt.Println("By orientation:")
+
+	for _, orientation := range []string{OrientationLandscape, OrientationPortrait, OrientationSquare} {
+		fmt.Printf("\t%s: %d\n", orientation, h.Orientation[orientation])
+	}
+}
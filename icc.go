@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var EmbedICC = ""
+
+var ErrInvalidICC = errors.New("not an ICC profile")
+
+var iccMagic = []byte("acsp")
+
+// CheckICCProfile makes sure path is readable and looks like an ICC profile
+// before any image is converted with it.
+func CheckICCProfile(path string) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	head := make([]byte, 40)
+
+	if _, err := io.ReadFull(file, head); err != nil || !bytes.Equal(head[36:40], iccMagic) {
+		return fmt.Errorf("%s: %w", path, ErrInvalidICC)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"strings"
+)
+
+var KeepICO = false
+
+var ErrInvalidICO = errors.New("invalid ICO file")
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func IsICO(header []byte) bool {
+	return bytes.HasPrefix(header, []byte{0, 0, 1, 0})
+}
+
+func IsICOPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".ico")
+}
+
+// LargestICOImage returns the largest bitmap of an ICO container as PNG,
+// preferring the deepest one of equal size. Bitmaps are stored either as PNG
+// or as headerless BMP, which libvips can't load.
+func LargestICOImage(data []byte) ([]byte, error) {
+	if len(data) < 6 || !IsICO(data) {
+		return nil, ErrInvalidICO
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+
+	var best []byte
+
+	bestPixels, bestBits := 0, 0
+
+	for i := 0; i < count; i++ {
+		start := 6 + 16*i
+
+		if start+16 > len(data) {
+			return nil, ErrInvalidICO
+		}
+
+		entry := data[start : start+16]
+		width, height := int(entry[0]), int(entry[1])
+
+		if width == 0 {
+			width = 256
+		}
+
+		if height == 0 {
+			height = 256
+		}
+
+		bits := int(binary.LittleEndian.Uint16(entry[6:]))
+		size := int(binary.LittleEndian.Uint32(entry[8:]))
+		offset := int(binary.LittleEndian.Uint32(entry[12:]))
+
+		if offset < 0 || size <= 0 || offset+size > len(data) {
+			return nil, ErrInvalidICO
+		}
+
+		if pixels := width * height; pixels > bestPixels || pixels == bestPixels && bits > bestBits {
+			best, bestPixels, bestBits = data[offset:offset+size], pixels, bits
+		}
+	}
+
+	if best == nil {
+		return nil, ErrInvalidICO
+	}
+
+	if bytes.HasPrefix(best, pngSignature) {
+		return best, nil
+	}
+
+	decoded, err := decodeDIB(best)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+
+	if err := png.Encode(&buffer, decoded); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// decodeDIB decodes an uncompressed bitmap of an ICO: a BITMAPINFOHEADER,
+// the palette, bottom-up rows of color, then the 1-bit transparency mask.
+func decodeDIB(data []byte) (image.Image, error) {
+	if len(data) < 40 {
+		return nil, ErrInvalidICO
+	}
+
+	headerSize := int(binary.LittleEndian.Uint32(data))
+	width := int(int32(binary.LittleEndian.Uint32(data[4:])))
+	height := int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+	bits := int(binary.LittleEndian.Uint16(data[14:]))
+	compression := binary.LittleEndian.Uint32(data[16:])
+	colors := int(binary.LittleEndian.Uint32(data[32:]))
+
+	if headerSize < 40 || headerSize > len(data) || width <= 0 || height <= 0 || width > 1024 || height > 1024 {
+		return nil, ErrInvalidICO
+	}
+
+	if compression != 0 && !(compression == 3 && bits == 32) {
+		return nil, ErrInvalidICO
+	}
+
+	var palette []color.NRGBA
+
+	offset := headerSize
+
+	switch bits {
+	case 1, 4, 8:
+		if colors == 0 {
+			colors = 1 << bits
+		}
+
+		if offset+colors*4 > len(data) {
+			return nil, ErrInvalidICO
+		}
+
+		for i := 0; i < colors; i++ {
+			c := data[offset+i*4:]
+
+			palette = append(palette, color.NRGBA{R: c[2], G: c[1], B: c[0], A: 0xff})
+		}
+
+		offset += colors * 4
+	case 24, 32:
+	default:
+		return nil, ErrInvalidICO
+	}
+
+	stride := (width*bits + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	mask := offset + stride*height
+
+	if mask > len(data) {
+		return nil, ErrInvalidICO
+	}
+
+	hasMask := mask+maskStride*height <= len(data)
+	hasAlpha := false
+	decoded := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		row := data[offset+(height-1-y)*stride:]
+
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+
+			switch bits {
+			case 32:
+				p := row[x*4:]
+				c = color.NRGBA{R: p[2], G: p[1], B: p[0], A: p[3]}
+				hasAlpha = hasAlpha || p[3] != 0
+			case 24:
+				p := row[x*3:]
+				c = color.NRGBA{R: p[2], G: p[1], B: p[0], A: 0xff}
+			default:
+				per := 8 / bits
+				index := int(row[x/per]>>(8-bits*(x%per+1))) & (1<<bits - 1)
+
+				if index >= len(palette) {
+					return nil, ErrInvalidICO
+				}
+
+				c = palette[index]
+			}
+
+			decoded.SetNRGBA(x, y, c)
+		}
+	}
+
+	// 32-bit bitmaps carry their own alpha, the mask only matters for the
+	// others, or for old icons with an empty alpha channel.
+	if hasMask && (bits != 32 || !hasAlpha) {
+		for y := 0; y < height; y++ {
+			row := data[mask+(height-1-y)*maskStride:]
+
+			for x := 0; x < width; x++ {
+				c := decoded.NRGBAAt(x, y)
+
+				c.A = 0xff
+
+				if row[x/8]&(0x80>>(x%8)) != 0 {
+					c.A = 0
+				}
+
+				decoded.SetNRGBA(x, y, c)
+			}
+		}
+	}
+
+	return decoded, nil
+}
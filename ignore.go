@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	IgnoreFileName    = ".avifyignore"
+	GitIgnoreFileName = ".gitignore"
+)
+
+var RespectGitignore = false
+
+type IgnoreRule struct {
+	Dir      string
+	Segments []string
+	Anchored bool
+	DirOnly  bool
+	Negate   bool
+}
+
+// LoadIgnoreFiles reads the .avifyignore of dir, preceded by its .gitignore
+// with --respect-gitignore, so the former may re-include what git ignores.
+func LoadIgnoreFiles(dir string) ([]IgnoreRule, error) {
+	var rules []IgnoreRule
+
+	names := []string{IgnoreFileName}
+
+	if RespectGitignore {
+		names = []string{GitIgnoreFileName, IgnoreFileName}
+	}
+
+	for _, name := range names {
+		loaded, err := LoadIgnoreFile(filepath.Join(dir, name))
+
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, loaded...)
+	}
+
+	return rules, nil
+}
+
+// LoadIgnoreFile reads a gitignore-style file: blank lines and # comments
+// are skipped, ! re-includes, a trailing slash matches directories only, and
+// patterns with a slash are relative to the directory of the file.
+func LoadIgnoreFile(path string) ([]IgnoreRule, error) {
+	dir := filepath.Dir(path)
+	file, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var rules []IgnoreRule
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := IgnoreRule{Dir: dir}
+
+		if rest, ok := strings.CutPrefix(line, "!"); ok {
+			rule.Negate, line = true, rest
+		}
+
+		line = strings.TrimPrefix(line, `\`)
+
+		if rest, ok := strings.CutSuffix(line, "/"); ok {
+			rule.DirOnly, line = true, rest
+		}
+
+		rule.Anchored = strings.Contains(line, "/")
+		rule.Segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+
+		if err := CheckExcludes([]string{line}); err != nil || line == "" {
+			return nil, fmt.Errorf("%s: invalid pattern %q", path, scanner.Text())
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+// IsIgnored applies rules in order, so later rules and nested files override
+// earlier ones, like in git.
+func IsIgnored(rules []IgnoreRule, path string, dir bool) bool {
+	ignored := false
+
+	for _, rule := range rules {
+		if rule.DirOnly && !dir {
+			continue
+		}
+
+		rel, err := filepath.Rel(rule.Dir, path)
+
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		segments := strings.Split(filepath.ToSlash(rel), "/")
+
+		if !rule.Anchored {
+			segments = segments[len(segments)-1:]
+		}
+
+		if matchSegments(rule.Segments, segments) {
+			ignored = !rule.Negate
+		}
+	}
+
+	return ignored
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ImportTakeout = "takeout"
+	ImportApple   = "apple"
+)
+
+const (
+	EditedBoth     = "both"
+	EditedOriginal = "original"
+	EditedOnly     = "edited"
+)
+
+var ImportProfile = ""
+
+var ImportEdited = EditedBoth
+
+var (
+	takeoutEdited   = regexp.MustCompile(`(?i)^(.+)-(edited|bearbeitet|modifié|editado|modificato|bewerkt)$`)
+	takeoutCopy     = regexp.MustCompile(`^(.+)\((\d+)\)(\.[^.]+)$`)
+	appleEdited     = regexp.MustCompile(`^(IMG_)E(\d+)$`)
+	takeoutSidecars = []string{".json", ".supplemental-metadata.json"}
+
+	// Takeout titles are usually just the uploaded file name.
+	takeoutFileTitle = regexp.MustCompile(AllowedExtensions + `|\.(heic|mp4|mov)$`)
+)
+
+// OriginalOf returns the path of the original an edited variant was derived
+// from in exports of the current import profile.
+func OriginalOf(path string) (string, bool) {
+	dir, name := filepath.Split(path)
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	var match []string
+
+	switch ImportProfile {
+	case ImportTakeout:
+		match = takeoutEdited.FindStringSubmatch(stem)
+	case ImportApple:
+		if match = appleEdited.FindStringSubmatch(stem); match != nil {
+			match = []string{match[0], match[1] + match[2]}
+		}
+	}
+
+	if match == nil {
+		return "", false
+	}
+
+	return filepath.Join(dir, match[1]+ext), true
+}
+
+// FilterVariants applies the ImportEdited policy to original/edited pairs
+// found among the jobs of discovery, skipping the side not imported.
+func FilterVariants(discovery *Discovery) {
+	if ImportProfile == "" || ImportEdited == EditedBoth {
+		return
+	}
+
+	jobs := discovery.Jobs
+
+	paths := map[string]bool{}
+	edited := map[string]bool{}
+
+	for _, job := range jobs {
+		paths[strings.ToLower(job.Path)] = true
+	}
+
+	for _, job := range jobs {
+		if original, ok := OriginalOf(job.Path); ok && paths[strings.ToLower(original)] {
+			edited[strings.ToLower(job.Path)] = true
+			edited[strings.ToLower(original)] = false
+		}
+	}
+
+	filtered := jobs[:0]
+
+	for _, job := range jobs {
+		isEdited, paired := edited[strings.ToLower(job.Path)]
+
+		if paired && isEdited == (ImportEdited == EditedOriginal) {
+			if isEdited {
+				discovery.Skip(SkipVariant, job.Path)
+			} else {
+				discovery.Skip(SkipOriginal, job.Path)
+			}
+
+			continue
+		}
+
+		filtered = append(filtered, job)
+	}
+
+	discovery.Jobs = filtered
+}
+
+type TakeoutMetadata struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+
+	PhotoTakenTime struct {
+		Timestamp string `json:"timestamp"`
+	} `json:"photoTakenTime"`
+
+	GeoData struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		Altitude  float64 `json:"altitude"`
+	} `json:"geoData"`
+}
+
+func takeoutSidecarCandidates(path string) []string {
+	dir, name := filepath.Split(path)
+
+	var candidates []string
+
+	for _, suffix := range takeoutSidecars {
+		candidates = append(candidates, path+suffix)
+
+		if match := takeoutCopy.FindStringSubmatch(name); match != nil {
+			candidates = append(candidates, filepath.Join(dir, match[1]+match[3]+strings.TrimSuffix(suffix, ".json")+"("+match[2]+").json"))
+		}
+	}
+
+	return append(candidates, strings.TrimSuffix(path, filepath.Ext(path))+".json")
+}
+
+func readTakeoutSidecar(path string) (*TakeoutMetadata, error) {
+	candidates := takeoutSidecarCandidates(path)
+
+	if original, ok := OriginalOf(path); ok {
+		candidates = append(candidates, takeoutSidecarCandidates(original)...)
+	}
+
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate)
+
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		metadata := &TakeoutMetadata{}
+
+		if err := json.Unmarshal(data, metadata); err != nil {
+			return nil, fmt.Errorf("%s: %w", candidate, err)
+		}
+
+		return metadata, nil
+	}
+
+	return nil, nil
+}
+
+func xmpEscape(text string) string {
+	var b strings.Builder
+
+	xml.EscapeText(&b, []byte(text))
+
+	return b.String()
+}
+
+func xmpCoordinate(value float64, positive, negative string) string {
+	ref := positive
+
+	if value < 0 {
+		ref = negative
+		value = -value
+	}
+
+	degrees := math.Floor(value)
+
+	return fmt.Sprintf("%d,%.6f%s", int(degrees), (value-degrees)*60, ref)
+}
+
+func (m *TakeoutMetadata) XMP() []byte {
+	var b strings.Builder
+
+	if m.Title != "" && !takeoutFileTitle.MatchString(strings.ToLower(m.Title)) {
+		fmt.Fprintf(&b, `<dc:title><rdf:Alt><rdf:li xml:lang="x-default">%s</rdf:li></rdf:Alt></dc:title>`, xmpEscape(m.Title))
+	}
+
+	if m.Description != "" {
+		fmt.Fprintf(&b, `<dc:description><rdf:Alt><rdf:li xml:lang="x-default">%s</rdf:li></rdf:Alt></dc:description>`, xmpEscape(m.Description))
+	}
+
+	if seconds, err := strconv.ParseInt(m.PhotoTakenTime.Timestamp, 10, 64); err == nil && seconds > 0 {
+		taken := time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+
+		fmt.Fprintf(&b, `<exif:DateTimeOriginal>%s</exif:DateTimeOriginal><photoshop:DateCreated>%s</photoshop:DateCreated>`, taken, taken)
+	}
+
+	if geo := m.GeoData; geo.Latitude != 0 || geo.Longitude != 0 {
+		fmt.Fprintf(&b, `<exif:GPSLatitude>%s</exif:GPSLatitude><exif:GPSLongitude>%s</exif:GPSLongitude>`,
+			xmpCoordinate(geo.Latitude, "N", "S"), xmpCoordinate(geo.Longitude, "E", "W"))
+
+		if geo.Altitude != 0 {
+			altitudeRef := 0
+
+			if geo.Altitude < 0 {
+				altitudeRef = 1
+			}
+
+			fmt.Fprintf(&b, `<exif:GPSAltitude>%d/100</exif:GPSAltitude><exif:GPSAltitudeRef>%d</exif:GPSAltitudeRef>`,
+				int(math.Abs(geo.Altitude)*100), altitudeRef)
+		}
+	}
+
+	if b.Len() == 0 {
+		return nil
+	}
+
+	return []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:exif="http://ns.adobe.com/exif/1.0/" xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/">` +
+		b.String() + `</rdf:Description></rdf:RDF></x:xmpmeta>`)
+}
+
+func readAppleSidecar(path string) ([]byte, error) {
+	candidates := []string{path + ".xmp"}
+	targets := []string{path}
+
+	if original, ok := OriginalOf(path); ok {
+		targets = append(targets, original)
+	}
+
+	for _, target := range targets {
+		stem := strings.TrimSuffix(target, filepath.Ext(target))
+
+		candidates = append(candidates, stem+".xmp", stem+".XMP")
+	}
+
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate)
+
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		return data, err
+	}
+
+	return nil, nil
+}
+
+// ImportXMP returns an XMP packet built from the export sidecars of path, or
+// nil when the import profile finds none.
+func ImportXMP(path string) ([]byte, error) {
+	switch ImportProfile {
+	case ImportTakeout:
+		metadata, err := readTakeoutSidecar(path)
+
+		if err != nil || metadata == nil {
+			return nil, err
+		}
+
+		return metadata.XMP(), nil
+	case ImportApple:
+		return readAppleSidecar(path)
+	}
+
+	return nil, nil
+}
+
+var (
+	rdfOpen  = regexp.MustCompile(`<rdf:RDF[^>]*>`)
+	rdfClose = []byte("</rdf:RDF>")
+)
+
+// MergeXMP moves the rdf:Description elements of packet into existing, so
+// metadata already embedded in the image is kept alongside the sidecar's.
+func MergeXMP(existing, packet []byte) []byte {
+	at := bytes.LastIndex(existing, rdfClose)
+	open := rdfOpen.FindIndex(packet)
+	end := bytes.LastIndex(packet, rdfClose)
+
+	if at < 0 || open == nil || end < open[1] {
+		if len(existing) > 0 {
+			return existing
+		}
+
+		return packet
+	}
+
+	merged := make([]byte, 0, len(existing)+end-open[1])
+
+	merged = append(merged, existing[:at]...)
+	merged = append(merged, packet[open[1]:end]...)
+
+	return append(merged, existing[at:]...)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilterVariants(t *testing.T) {
+	defer func(profile, edited string) { ImportProfile, ImportEdited = profile, edited }(ImportProfile, ImportEdited)
+
+	ImportProfile = ImportApple
+
+	for policy, want := range map[string]struct {
+		kept   []string
+		reason SkipReason
+	}{
+		EditedOriginal: {kept: []string{"/photos/IMG_0001.jpg", "/photos/IMG_0002.jpg"}, reason: SkipVariant},
+		EditedOnly:     {kept: []string{"/photos/IMG_0002.jpg", "/photos/IMG_E0001.jpg"}, reason: SkipOriginal},
+	} {
+		ImportEdited = policy
+
+		discovery := &Discovery{Skipped: map[SkipReason]int{}}
+
+		for _, path := range []string{"/photos/IMG_0001.jpg", "/photos/IMG_E0001.jpg", "/photos/IMG_0002.jpg"} {
+			discovery.Jobs = append(discovery.Jobs, &Job{Root: "/photos", Path: path})
+		}
+
+		FilterVariants(discovery)
+
+		if got := jobPaths(discovery); !slices.Equal(got, want.kept) {
+			t.Errorf("%s: kept %v, want %v", policy, got, want.kept)
+		}
+
+		if discovery.Skipped[want.reason] != 1 {
+			t.Errorf("%s: skipped %v, want one %q", policy, discovery.Skipped, want.reason)
+		}
+	}
+}
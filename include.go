@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var Extensions []string
+
+var IncludePattern string
+
+var include *regexp.Regexp
+
+var knownExtensions = []string{"gif", "jpg", "jpeg", "png", "webp", "ico", "heic", "heif", "hif", "svg"}
+
+func CheckFilters() error {
+	for _, ext := range Extensions {
+		if !slices.Contains(knownExtensions, normalizeExt(ext)) {
+			return fmt.Errorf("unsupported extension %q, expected one of %s", ext, strings.Join(knownExtensions, ", "))
+		}
+	}
+
+	if IncludePattern == "" {
+		include = nil
+
+		return nil
+	}
+
+	r, err := regexp.Compile(IncludePattern)
+
+	if err != nil {
+		return fmt.Errorf("invalid include pattern: %w", err)
+	}
+
+	include = r
+
+	return nil
+}
+
+// HasWantedExtension checks the path against --ext. jpg and jpeg are the
+// same format, so either of them selects both.
+func HasWantedExtension(path string) bool {
+	return len(Extensions) == 0 || HasExtension(path, Extensions)
+}
+
+// HasExtension checks the path against the extensions of --ext or a format
+// setting.
+func HasExtension(path string, extensions []string) bool {
+	ext := normalizeExt(filepath.Ext(path))
+
+	for _, wanted := range extensions {
+		wanted = normalizeExt(wanted)
+
+		if wanted == ext || wanted == "jpg" && ext == "jpeg" || wanted == "jpeg" && ext == "jpg" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func IsIncluded(path string) bool {
+	return include == nil || include.MatchString(path)
+}
+
+func normalizeExt(ext string) string {
+	return strings.ToLower(strings.TrimPrefix(ext, "."))
+}
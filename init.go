@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/demiazz/avify/internal/vips"
+	"github.com/spf13/cobra"
+)
+
+var initQualities = []int{50, 60, 70, 80, 90}
+
+// initTargetSSIM is the similarity the suggested quality must keep on
+// average over the sample.
+const initTargetSSIM = 0.97
+
+type QualityTrial struct {
+	Quality int
+	Before  uint64
+	After   uint64
+	SSIM    float64
+}
+
+func (t QualityTrial) Savings() float64 {
+	if t.Before == 0 || t.After >= t.Before {
+		return 0
+	}
+
+	return float64(t.Before-t.After) / float64(t.Before)
+}
+
+type Suggestion struct {
+	Trials   []QualityTrial
+	Quality  int
+	Jobs     int
+	Ext      []string
+	Animated int
+	Sampled  int
+	Total    uint64
+}
+
+// SuggestSettings encodes a stratified sample of jobs with every quality of
+// initQualities, and picks the lowest one that keeps initTargetSSIM.
+func SuggestSettings(jobs []*Job, count int) (*Suggestion, error) {
+	strata := map[string][]string{}
+	suggestion := &Suggestion{Trials: make([]QualityTrial, len(initQualities))}
+
+	for i, quality := range initQualities {
+		suggestion.Trials[i].Quality = quality
+	}
+
+	for _, job := range jobs {
+		name, err := Stratum(job.Path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		strata[name] = append(strata[name], job.Path)
+
+		if info, err := os.Stat(job.Path); err == nil {
+			suggestion.Total += uint64(info.Size())
+		}
+	}
+
+	sample := SampleStrata(strata, count, 1)
+	largest := 0
+
+	for _, name := range slices.Sorted(maps.Keys(sample)) {
+		for _, path := range sample[name] {
+			pixels, animated, err := trySample(path, suggestion.Trials)
+
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+
+			largest = max(largest, pixels)
+			suggestion.Sampled += 1
+
+			if animated {
+				suggestion.Animated += 1
+			}
+		}
+	}
+
+	suggestion.Quality = initQualities[len(initQualities)-1]
+
+	for i := range suggestion.Trials {
+		trial := &suggestion.Trials[i]
+
+		if suggestion.Sampled > 0 {
+			trial.SSIM /= float64(suggestion.Sampled)
+		}
+	}
+
+	for _, trial := range suggestion.Trials {
+		if trial.SSIM >= initTargetSSIM {
+			suggestion.Quality = trial.Quality
+
+			break
+		}
+	}
+
+	// Every worker holds a decoded image, so huge images get half the CPUs.
+	suggestion.Jobs = runtime.NumCPU()
+
+	if largest >= 32_000_000 {
+		suggestion.Jobs = max(1, suggestion.Jobs/2)
+	}
+
+	if suggestion.Animated > 0 {
+		suggestion.Ext = []string{"jpg", "png", "webp"}
+	}
+
+	return suggestion, nil
+}
+
+func trySample(path string, trials []QualityTrial) (int, bool, error) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	image, err := vips.NewImageFromFile(path)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	defer image.Close()
+
+	before, width, height, err := GrayscaleSample(image)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	for i := range trials {
+		params := *AvifExportParams
+
+		params.Quality = trials[i].Quality
+
+		bytes, err := ExportAvif(image, &params)
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		score, err := encodedSSIM(before, width, height, bytes)
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		trials[i].Before += uint64(info.Size())
+		trials[i].After += uint64(len(bytes))
+		trials[i].SSIM += score
+	}
+
+	return image.Width() * image.Height(), image.Pages() > 1, nil
+}
+
+func (s *Suggestion) Print(w io.Writer) {
+	fmt.Fprintf(w, "Sampled %d images of %s:\n", s.Sampled, FormatBytes(s.Total))
+
+	for _, trial := range s.Trials {
+		projected := uint64(float64(s.Total) * trial.Savings())
+
+		fmt.Fprintf(w, "\tquality %d: %.1f%% smaller, SSIM %.3f, saves about %s\n", trial.Quality, trial.Savings()*100, trial.SSIM, FormatBytes(projected))
+	}
+
+	if s.Animated > 0 {
+		fmt.Fprintf(w, "%d sampled images are animated, GIFs are better left alone\n", s.Animated)
+	}
+}
+
+// ask prints the question with the suggested answer, which an empty line
+// accepts.
+func ask(scanner *bufio.Scanner, w io.Writer, question, suggested string) string {
+	fmt.Fprintf(w, "%s [%s]: ", question, suggested)
+
+	if !scanner.Scan() {
+		fmt.Fprintln(w)
+
+		return suggested
+	}
+
+	if answer := strings.TrimSpace(scanner.Text()); answer != "" {
+		return answer
+	}
+
+	return suggested
+}
+
+// WriteConfig sets keys in the config file at path, keeping its other lines
+// and comments as they are.
+func WriteConfig(path string, values map[string]string) error {
+	data, err := os.ReadFile(path)
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	var lines []string
+
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+
+	pending := maps.Clone(values)
+
+	for i, line := range lines {
+		key, _, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+
+		if value, found := pending[key]; ok && found {
+			lines[i] = key + " = " + value
+
+			delete(pending, key)
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(pending)) {
+		lines = append(lines, key+" = "+pending[key])
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func NewInitCmd() *cobra.Command {
+	var count int
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "init DIR",
+		Short: "Suggest settings from a sample of DIR and write them to the config file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if count <= 0 {
+				return fmt.Errorf("invalid sample size %d", count)
+			}
+
+			path := ConfigPath
+
+			if path == "" {
+				var err error
+
+				if path, err = DefaultConfigPath(); err != nil {
+					return err
+				}
+			}
+
+			discovery, err := FindImagesAt(args[0])
+
+			if err != nil {
+				return err
+			}
+
+			if len(discovery.Jobs) == 0 {
+				return fmt.Errorf("no images found in %s", args[0])
+			}
+
+			suggestion, err := SuggestSettings(discovery.Jobs, count)
+
+			if err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+
+			suggestion.Print(w)
+
+			values := map[string]string{
+				"quality": strconv.Itoa(suggestion.Quality),
+				"jobs":    strconv.Itoa(suggestion.Jobs),
+			}
+
+			if len(suggestion.Ext) > 0 {
+				values["ext"] = strconv.Quote(strings.Join(suggestion.Ext, ","))
+			}
+
+			if !yes {
+				scanner := bufio.NewScanner(cmd.InOrStdin())
+
+				values["quality"] = ask(scanner, w, "Quality", values["quality"])
+				values["jobs"] = ask(scanner, w, "Parallel conversions", values["jobs"])
+
+				if ext, ok := values["ext"]; ok {
+					if answer := ask(scanner, w, "Only convert extensions (- for all)", ext); answer != "-" {
+						values["ext"] = strconv.Quote(strings.Trim(answer, `"`))
+					} else {
+						delete(values, "ext")
+					}
+				}
+
+				if answer := ask(scanner, w, "Write to "+path+"?", "y"); !strings.HasPrefix(strings.ToLower(answer), "y") {
+					return nil
+				}
+			}
+
+			if _, err := parseBoundedInt(values["quality"], 1, 100); err != nil {
+				return fmt.Errorf("quality: %w", err)
+			}
+
+			if jobs, err := strconv.Atoi(values["jobs"]); err != nil || jobs < 1 {
+				return fmt.Errorf("invalid number of parallel conversions %q", values["jobs"])
+			}
+
+			if err := WriteConfig(path, values); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(w, "Written to %s\n", path)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&count, "sample", 20, "approximate number of images to try the settings on")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "write the suggested settings without asking")
+
+	return cmd
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/demiazz/avify/internal/vips"
+	"github.com/spf13/cobra"
+)
+
+var formatNames = map[vips.ImageType]string{
+	vips.ImageTypeGIF:  "GIF",
+	vips.ImageTypeJPEG: "JPEG",
+	vips.ImageTypePNG:  "PNG",
+	vips.ImageTypeWEBP: "WebP",
+	vips.ImageTypeAVIF: "AVIF",
+	vips.ImageTypeHEIF: "HEIF",
+	vips.ImageTypeTIFF: "TIFF",
+	vips.ImageTypeSVG:  "SVG",
+	vips.ImageTypeBMP:  "BMP",
+	vips.ImageTypeJP2K: "JPEG 2000",
+	vips.ImageTypeJXL:  "JPEG XL",
+	vips.ImageTypePDF:  "PDF",
+}
+
+var sampleBits = map[vips.BandFormat]int{
+	vips.BandFormatUchar:     8,
+	vips.BandFormatChar:      8,
+	vips.BandFormatUshort:    16,
+	vips.BandFormatShort:     16,
+	vips.BandFormatUint:      32,
+	vips.BandFormatInt:       32,
+	vips.BandFormatFloat:     32,
+	vips.BandFormatComplex:   64,
+	vips.BandFormatDouble:    64,
+	vips.BandFormatDpComplex: 128,
+}
+
+var exifSummary = []string{"Make", "Model", "LensModel", "DateTimeOriginal", "Orientation", "Software"}
+
+func FormatName(format vips.ImageType) string {
+	if name, ok := formatNames[format]; ok {
+		return name
+	}
+
+	return "unknown"
+}
+
+func InspectImage(w io.Writer, path string) error {
+	image, err := vips.NewImageFromFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer image.Close()
+
+	bits := sampleBits[image.BandFormat()]
+	pages := max(image.Pages(), 1)
+	memory := uint64(image.Width()) * uint64(image.Height()) * uint64(image.Bands()) * uint64(bits/8) * uint64(pages)
+
+	fmt.Fprintf(w, "Format: %s\n", FormatName(image.Format()))
+	fmt.Fprintf(w, "Dimensions: %dx%d\n", image.Width(), image.Height())
+	fmt.Fprintf(w, "Bands: %d (alpha: %t)\n", image.Bands(), image.HasAlpha())
+	fmt.Fprintf(w, "Bit depth: %d\n", bits)
+	fmt.Fprintf(w, "Frames: %d\n", pages)
+
+	if image.HasICCProfile() {
+		fmt.Fprintf(w, "ICC profile: %s\n", FormatBytes(uint64(len(image.GetICCProfile()))))
+	} else {
+		fmt.Fprintln(w, "ICC profile: none")
+	}
+
+	exif := image.GetExif()
+
+	if len(exif) == 0 {
+		fmt.Fprintln(w, "EXIF: none")
+	} else {
+		fmt.Fprintf(w, "EXIF: %d fields\n", len(exif))
+
+		for _, name := range exifSummary {
+			if value := ExifValue(exif, name); value != "" {
+				fmt.Fprintf(w, "\t%s: %s\n", name, value)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "Estimated decoded memory: %s\n", FormatBytes(memory))
+
+	return nil
+}
+
+func InspectBoxes(w io.Writer, path string) error {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	parsed, err := ParseBoxes(data)
+
+	if len(parsed) == 0 || parsed[0].Type != "ftyp" {
+		return ErrNoFileTypeBox
+	}
+
+	fmt.Fprintln(w, "Boxes:")
+
+	DumpBoxes(w, parsed, 1)
+
+	return err
+}
+
+func NewInspectCmd() *cobra.Command {
+	var boxes bool
+
+	cmd := &cobra.Command{
+		Use:   "inspect FILE",
+		Short: "Show metadata of an image, and optionally the container structure of AVIF/HEIF files",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var boxesErr error
+
+			// The container is parsed without vips, so a file vips cannot decode still gets its structure dumped.
+			if boxes {
+				boxesErr = InspectBoxes(os.Stdout, args[0])
+			}
+
+			return errors.Join(boxesErr, InspectImage(os.Stdout, args[0]))
+		},
+	}
+
+	cmd.Flags().BoolVar(&boxes, "boxes", false, "also dump the ISOBMFF box structure")
+
+	return cmd
+}
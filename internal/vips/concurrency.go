@@ -0,0 +1,17 @@
+//go:build !fake
+
+package vips
+
+// #cgo pkg-config: vips
+// #include <vips/vips.h>
+import "C"
+
+// ConcurrencySet changes the number of threads libvips uses per image, which
+// govips only allows to set at startup.
+func ConcurrencySet(threads int) {
+	C.vips_concurrency_set(C.int(threads))
+}
+
+func ConcurrencyGet() int {
+	return int(C.vips_concurrency_get())
+}
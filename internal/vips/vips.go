@@ -0,0 +1,101 @@
+//go:build !fake
+
+// Package vips is the part of govips avify uses. Builds with the fake tag
+// replace it with a pure Go stand-in, so they need neither cgo nor libvips.
+package vips
+
+import (
+	"io"
+
+	govips "github.com/davidbyttow/govips/v2/vips"
+)
+
+type (
+	AvifExportParams = govips.AvifExportParams
+	BandFormat       = govips.BandFormat
+	Config           = govips.Config
+	ImageRef         = govips.ImageRef
+	ImageType        = govips.ImageType
+	ImportParams     = govips.ImportParams
+	Interpretation   = govips.Interpretation
+	Kernel           = govips.Kernel
+	LogLevel         = govips.LogLevel
+	MemoryStats      = govips.MemoryStats
+)
+
+const (
+	BandFormatUchar     = govips.BandFormatUchar
+	BandFormatChar      = govips.BandFormatChar
+	BandFormatUshort    = govips.BandFormatUshort
+	BandFormatShort     = govips.BandFormatShort
+	BandFormatUint      = govips.BandFormatUint
+	BandFormatInt       = govips.BandFormatInt
+	BandFormatFloat     = govips.BandFormatFloat
+	BandFormatComplex   = govips.BandFormatComplex
+	BandFormatDouble    = govips.BandFormatDouble
+	BandFormatDpComplex = govips.BandFormatDpComplex
+)
+
+const (
+	ImageTypeGIF  = govips.ImageTypeGIF
+	ImageTypeJPEG = govips.ImageTypeJPEG
+	ImageTypePNG  = govips.ImageTypePNG
+	ImageTypeWEBP = govips.ImageTypeWEBP
+	ImageTypeAVIF = govips.ImageTypeAVIF
+	ImageTypeHEIF = govips.ImageTypeHEIF
+	ImageTypeTIFF = govips.ImageTypeTIFF
+	ImageTypeSVG  = govips.ImageTypeSVG
+	ImageTypeBMP  = govips.ImageTypeBMP
+	ImageTypeJP2K = govips.ImageTypeJP2K
+	ImageTypeJXL  = govips.ImageTypeJXL
+	ImageTypePDF  = govips.ImageTypePDF
+)
+
+const (
+	InterpretationBW = govips.InterpretationBW
+	KernelLinear     = govips.KernelLinear
+	KernelLanczos3   = govips.KernelLanczos3
+	LogLevelError    = govips.LogLevelError
+)
+
+var Version = govips.Version
+
+func Startup(config *Config) {
+	govips.Startup(config)
+}
+
+func Shutdown() {
+	govips.Shutdown()
+}
+
+func ClearCache() {
+	govips.ClearCache()
+}
+
+func LoggingSettings(handler func(domain string, level LogLevel, message string), verbosity LogLevel) {
+	govips.LoggingSettings(handler, verbosity)
+}
+
+func ReadVipsMemStats(stats *MemoryStats) {
+	govips.ReadVipsMemStats(stats)
+}
+
+func NewImportParams() *ImportParams {
+	return govips.NewImportParams()
+}
+
+func NewImageFromFile(path string) (*ImageRef, error) {
+	return govips.NewImageFromFile(path)
+}
+
+func NewImageFromBuffer(data []byte) (*ImageRef, error) {
+	return govips.NewImageFromBuffer(data)
+}
+
+func NewImageFromReader(r io.Reader) (*ImageRef, error) {
+	return govips.NewImageFromReader(r)
+}
+
+func LoadImageFromBuffer(data []byte, params *ImportParams) (*ImageRef, error) {
+	return govips.LoadImageFromBuffer(data, params)
+}
@@ -0,0 +1,279 @@
+//go:build fake
+
+package vips
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrUnavailable is returned by every operation that would need libvips.
+var ErrUnavailable = errors.New("vips: not available in fake builds")
+
+type BandFormat int
+
+const (
+	BandFormatUchar BandFormat = iota
+	BandFormatChar
+	BandFormatUshort
+	BandFormatShort
+	BandFormatUint
+	BandFormatInt
+	BandFormatFloat
+	BandFormatComplex
+	BandFormatDouble
+	BandFormatDpComplex
+)
+
+type ImageType int
+
+const (
+	ImageTypeGIF ImageType = iota + 1
+	ImageTypeJPEG
+	ImageTypePNG
+	ImageTypeWEBP
+	ImageTypeAVIF
+	ImageTypeHEIF
+	ImageTypeTIFF
+	ImageTypeSVG
+	ImageTypeBMP
+	ImageTypeJP2K
+	ImageTypeJXL
+	ImageTypePDF
+)
+
+type Interpretation int
+
+const InterpretationBW Interpretation = 1
+
+type Kernel int
+
+const (
+	KernelLinear Kernel = iota + 1
+	KernelLanczos3
+)
+
+type LogLevel int
+
+const LogLevelError LogLevel = 1
+
+type Config struct {
+	ConcurrencyLevel int
+	MaxCacheFiles    int
+	MaxCacheMem      int
+	MaxCacheSize     int
+	ReportLeaks      bool
+	CacheTrace       bool
+	CollectStats     bool
+}
+
+type MemoryStats struct {
+	Mem     int64
+	MemHigh int64
+	Files   int64
+	Allocs  int64
+}
+
+type AvifExportParams struct {
+	StripMetadata bool
+	Quality       int
+	Bitdepth      int
+	Effort        int
+	Lossless      bool
+	Speed         int
+}
+
+type IntParameter struct {
+	value *int
+}
+
+func (p *IntParameter) Set(v int) {
+	p.value = &v
+}
+
+func (p *IntParameter) Get() int {
+	if p.value == nil {
+		return 0
+	}
+
+	return *p.value
+}
+
+type ImportParams struct {
+	Density IntParameter
+}
+
+var Version = "fake"
+
+func Startup(config *Config) {}
+
+func Shutdown() {}
+
+func ClearCache() {}
+
+func LoggingSettings(handler func(domain string, level LogLevel, message string), verbosity LogLevel) {
+}
+
+func ReadVipsMemStats(stats *MemoryStats) {}
+
+func NewImportParams() *ImportParams {
+	return &ImportParams{}
+}
+
+func NewImageFromFile(path string) (*ImageRef, error) {
+	return nil, ErrUnavailable
+}
+
+func NewImageFromBuffer(data []byte) (*ImageRef, error) {
+	return nil, ErrUnavailable
+}
+
+func NewImageFromReader(r io.Reader) (*ImageRef, error) {
+	return nil, ErrUnavailable
+}
+
+func LoadImageFromBuffer(data []byte, params *ImportParams) (*ImageRef, error) {
+	return nil, ErrUnavailable
+}
+
+// ImageRef can't be created in fake builds, its methods only exist so the
+// code around them compiles.
+type ImageRef struct{}
+
+type ImageMetadata struct{}
+
+func (r *ImageRef) Width() int {
+	return 0
+}
+
+func (r *ImageRef) Height() int {
+	return 0
+}
+
+func (r *ImageRef) Bands() int {
+	return 0
+}
+
+func (r *ImageRef) Pages() int {
+	return 0
+}
+
+func (r *ImageRef) Close() {}
+
+func (r *ImageRef) Format() ImageType {
+	return 0
+}
+
+func (r *ImageRef) BandFormat() BandFormat {
+	return BandFormatUchar
+}
+
+func (r *ImageRef) HasAlpha() bool {
+	return false
+}
+
+func (r *ImageRef) HasICCProfile() bool {
+	return false
+}
+
+func (r *ImageRef) GetICCProfile() []byte {
+	return nil
+}
+
+func (r *ImageRef) GetExif() map[string]string {
+	return nil
+}
+
+func (r *ImageRef) GetBlob(name string) []byte {
+	return nil
+}
+
+func (r *ImageRef) SetBlob(name string, data []byte) {}
+
+func (r *ImageRef) Copy() (*ImageRef, error) {
+	return nil, ErrUnavailable
+}
+
+func (r *ImageRef) ExtractBandToImage(band int, num int) (*ImageRef, error) {
+	return nil, ErrUnavailable
+}
+
+func (r *ImageRef) ExportAvif(params *AvifExportParams) ([]byte, *ImageMetadata, error) {
+	return nil, nil, ErrUnavailable
+}
+
+func (r *ImageRef) Add(addend *ImageRef) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) BandJoin(images ...*ImageRef) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) Cast(format BandFormat) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) ExtractBand(band int, num int) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) Multiply(multiplier *ImageRef) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) PremultiplyAlpha() error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) UnpremultiplyAlpha() error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) Resize(scale float64, kernel Kernel) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) ToColorSpace(interpretation Interpretation) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) TransformICCProfile(outputProfilePath string) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) GaussianBlur(sigmas ...float64) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) Linear1(a, b float64) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) ArrayJoin(images []*ImageRef, across int) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) SetPageHeight(height int) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) SetPageDelay(delay []int) error {
+	return ErrUnavailable
+}
+
+func (r *ImageRef) ToBytes() ([]byte, error) {
+	return nil, ErrUnavailable
+}
+
+func (r *ImageRef) SetInt(name string, i int) {}
+
+var concurrency = 1
+
+func ConcurrencySet(threads int) {
+	concurrency = threads
+}
+
+func ConcurrencyGet() int {
+	return concurrency
+}
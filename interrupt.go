@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// InterruptContext is cancelled by the first SIGINT or SIGTERM, so running
+// conversions finish and no new ones start. A second one kills the process
+// as usual, leaving .tmp outputs for avify clean.
+func InterruptContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "Interrupted, finishing running conversions, interrupt again to quit now")
+
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// Interrupted tells whether the run stopped on a signal before all of its
+// jobs were processed.
+func Interrupted(ctx context.Context, stats *Stats, jobs []*Job) bool {
+	return ctx.Err() != nil && len(stats.Results) < len(jobs)
+}
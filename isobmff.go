@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrMalformedBox = errors.New("malformed ISOBMFF box")
+
+var ErrNoFileTypeBox = errors.New("no ftyp box at the start of the file")
+
+type Box struct {
+	Type     string
+	Offset   int64
+	Size     int64
+	Payload  []byte
+	Children []*Box
+}
+
+var containerBoxes = map[string]int{
+	"moov": 0,
+	"trak": 0,
+	"mdia": 0,
+	"minf": 0,
+	"stbl": 0,
+	"dinf": 0,
+	"edts": 0,
+	"iprp": 0,
+	"ipco": 0,
+	"grpl": 0,
+	"meta": 4,
+	"iref": 4,
+}
+
+func ParseBoxes(data []byte) ([]*Box, error) {
+	return parseBoxes(data, 0)
+}
+
+func parseBoxes(data []byte, base int64) ([]*Box, error) {
+	var boxes []*Box
+
+	for offset := int64(0); offset < int64(len(data)); {
+		if int64(len(data))-offset < 8 {
+			return boxes, ErrMalformedBox
+		}
+
+		size := int64(binary.BigEndian.Uint32(data[offset:]))
+		kind := string(data[offset+4 : offset+8])
+		header := int64(8)
+
+		switch size {
+		case 0:
+			size = int64(len(data)) - offset
+		case 1:
+			if int64(len(data))-offset < 16 {
+				return boxes, ErrMalformedBox
+			}
+
+			size = int64(binary.BigEndian.Uint64(data[offset+8:]))
+			header = 16
+		}
+
+		// Compared against what is left, as offset+size overflows for a
+		// largesize close to the maximum.
+		if size < header || size > int64(len(data))-offset {
+			return boxes, ErrMalformedBox
+		}
+
+		box := &Box{
+			Type:    kind,
+			Offset:  base + offset,
+			Size:    size,
+			Payload: data[offset+header : offset+size],
+		}
+
+		if skip, ok := containerBoxes[kind]; ok && len(box.Payload) >= skip {
+			children, err := parseBoxes(box.Payload[skip:], box.Offset+header+int64(skip))
+
+			if err != nil {
+				return boxes, err
+			}
+
+			box.Children = children
+		}
+
+		if kind == "iinf" && len(box.Payload) >= 4 {
+			skip := 6
+
+			if box.Payload[0] != 0 {
+				skip = 8
+			}
+
+			if len(box.Payload) >= skip {
+				children, err := parseBoxes(box.Payload[skip:], box.Offset+header+int64(skip))
+
+				if err != nil {
+					return boxes, err
+				}
+
+				box.Children = children
+			}
+		}
+
+		boxes = append(boxes, box)
+
+		offset += size
+	}
+
+	return boxes, nil
+}
+
+func (b *Box) Describe() string {
+	p := b.Payload
+
+	switch b.Type {
+	case "ftyp":
+		if len(p) < 8 {
+			break
+		}
+
+		var compatible []string
+
+		for i := 8; i+4 <= len(p); i += 4 {
+			compatible = append(compatible, string(p[i:i+4]))
+		}
+
+		return fmt.Sprintf("major=%s minor=%d compatible=%s", p[0:4], binary.BigEndian.Uint32(p[4:8]), strings.Join(compatible, ","))
+	case "hdlr":
+		if len(p) >= 12 {
+			return fmt.Sprintf("handler=%s", p[8:12])
+		}
+	case "ispe":
+		if len(p) >= 12 {
+			return fmt.Sprintf("width=%d height=%d", binary.BigEndian.Uint32(p[4:8]), binary.BigEndian.Uint32(p[8:12]))
+		}
+	case "pitm":
+		if len(p) >= 6 {
+			return fmt.Sprintf("item=%d", binary.BigEndian.Uint16(p[4:6]))
+		}
+	case "pixi":
+		if len(p) >= 5 {
+			depths := make([]string, 0, p[4])
+
+			for i := 0; i < int(p[4]) && 5+i < len(p); i++ {
+				depths = append(depths, fmt.Sprint(p[5+i]))
+			}
+
+			return fmt.Sprintf("bits=%s", strings.Join(depths, ","))
+		}
+	case "infe":
+		if len(p) >= 12 && p[0] >= 2 {
+			return fmt.Sprintf("item=%d type=%s", binary.BigEndian.Uint16(p[4:6]), p[8:12])
+		}
+	}
+
+	return ""
+}
+
+func DumpBoxes(w io.Writer, boxes []*Box, depth int) {
+	for _, box := range boxes {
+		fmt.Fprintf(w, "%s%s offset=%d size=%d", strings.Repeat("  ", depth), box.Type, box.Offset, box.Size)
+
+		if description := box.Describe(); description != "" {
+			fmt.Fprintf(w, " %s", description)
+		}
+
+		fmt.Fprintln(w)
+
+		DumpBoxes(w, box.Children, depth+1)
+	}
+}
+
+func SetMajorBrand(data []byte, brand string) error {
+	if len(brand) != 4 {
+		return fmt.Errorf("brand %q must be exactly four characters", brand)
+	}
+
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return ErrNoFileTypeBox
+	}
+
+	copy(data[8:12], brand)
+
+	return nil
+}
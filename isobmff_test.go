@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// box encodes a box with a 32-bit size, or with size 1 and the largesize
+// when largesize isn't 0.
+func box(kind string, size uint32, largesize uint64, payload []byte) []byte {
+	data := binary.BigEndian.AppendUint32(nil, size)
+	data = append(data, kind...)
+
+	if largesize != 0 {
+		data = binary.BigEndian.AppendUint64(data, largesize)
+	}
+
+	return append(data, payload...)
+}
+
+func TestParseBoxesMalformed(t *testing.T) {
+	valid := box("ftyp", 16, 0, []byte("heicmif1"))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "largesize close to the maximum", data: append(valid, box("mdat", 1, 0x7ffffffffffffff8, make([]byte, 16))...)},
+		{name: "largesize above the maximum", data: append(valid, box("mdat", 1, 0xfffffffffffffff0, make([]byte, 16))...)},
+		{name: "largesize below the header", data: append(valid, box("mdat", 1, 8, make([]byte, 16))...)},
+		{name: "size below the header", data: append(valid, box("free", 4, 0, nil)...)},
+		{name: "size past the end", data: append(valid, box("free", 64, 0, make([]byte, 8))...)},
+		{name: "truncated header", data: append(valid, 0, 0, 0)},
+		{name: "truncated largesize", data: append(valid, box("mdat", 1, 0, []byte{0, 0, 0})...)},
+		{name: "malformed child", data: box("meta", 28, 0, append(make([]byte, 4), box("pitm", 1, 0x7ffffffffffffff8, nil)...))},
+	}
+
+	for _, test := range tests {
+		boxes, err := ParseBoxes(test.data)
+
+		if !errors.Is(err, ErrMalformedBox) {
+			t.Errorf("%s: error %v, want %v", test.name, err, ErrMalformedBox)
+		}
+
+		if test.name != "malformed child" && (len(boxes) != 1 || boxes[0].Type != "ftyp") {
+			t.Errorf("%s: parsed %d boxes, want the valid ftyp", test.name, len(boxes))
+		}
+	}
+}
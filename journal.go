@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const JournalName = ".avify-journal"
+
+const (
+	JournalDelete  = "delete"
+	JournalDeleted = "deleted"
+)
+
+type journal struct {
+	file    *os.File
+	pending int
+}
+
+var (
+	journalMu sync.Mutex
+	journals  = map[string]*journal{}
+)
+
+// Journal records deletions of originals in the root, so `avify clean` can
+// finish or roll them back after a crash. A journal without pending
+// deletions is removed when the run ends.
+func Journal(root, action, path, output string) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	j := journals[root]
+
+	if j == nil {
+		file, err := os.OpenFile(filepath.Join(root, JournalName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+
+		if err != nil {
+			return err
+		}
+
+		j = &journal{file: file}
+		journals[root] = j
+	}
+
+	if _, err := fmt.Fprintf(j.file, "%s\t%s\t%s\t%s\n", action, strconv.Quote(path), strconv.Quote(output), RunID); err != nil {
+		return err
+	}
+
+	switch action {
+	case JournalDelete:
+		j.pending += 1
+	case JournalDeleted:
+		j.pending -= 1
+	}
+
+	return j.file.Sync()
+}
+
+func CloseJournals() {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	for root, j := range journals {
+		j.file.Close()
+
+		if j.pending == 0 {
+			os.Remove(j.file.Name())
+		}
+
+		delete(journals, root)
+	}
+}
+
+type PendingDelete struct {
+	Path   string
+	Output string
+}
+
+func ReadJournal(root string) ([]*PendingDelete, error) {
+	file, err := os.Open(filepath.Join(root, JournalName))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var order []string
+
+	pending := map[string]*PendingDelete{}
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+
+		if len(fields) < 3 {
+			continue
+		}
+
+		path, err := strconv.Unquote(fields[1])
+
+		if err != nil {
+			continue
+		}
+
+		output, err := strconv.Unquote(fields[2])
+
+		if err != nil {
+			continue
+		}
+
+		switch fields[0] {
+		case JournalDelete:
+			if pending[path] == nil {
+				order = append(order, path)
+			}
+
+			pending[path] = &PendingDelete{Path: path, Output: output}
+		case JournalDeleted:
+			delete(pending, path)
+		}
+	}
+
+	var deletes []*PendingDelete
+
+	for _, path := range order {
+		if pending[path] != nil {
+			deletes = append(deletes, pending[path])
+		}
+	}
+
+	return deletes, scanner.Err()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+const KnownBadName = "known-bad.json"
+
+var SkipKnownBad = false
+
+var KnownBadAttempts = 3
+
+type KnownBad struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// KnownBadList maps the SHA-256 of files that failed to their failures, so
+// the same content failing the same way is recognized under any path.
+type KnownBadList map[string]*KnownBad
+
+func LoadKnownBad() (KnownBadList, string, error) {
+	path, err := StatePath(KnownBadName)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	list := KnownBadList{}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return list, path, nil
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	return list, path, nil
+}
+
+func (l KnownBadList) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	tmp := path + TempExt
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (l KnownBadList) Record(results []*Result) {
+	for _, result := range results {
+		if result.Status != StatusFailed {
+			continue
+		}
+
+		info, err := os.Stat(result.Path)
+
+		if err != nil {
+			continue
+		}
+
+		hash, err := HashFile(result.Path)
+
+		if err != nil {
+			continue
+		}
+
+		entry := l[hash]
+
+		if entry == nil || entry.Error != result.Error {
+			entry = &KnownBad{Error: result.Error}
+			l[hash] = entry
+		}
+
+		entry.Path = result.Path
+		entry.Size = info.Size()
+		entry.Attempts += 1
+		entry.LastSeen = time.Now()
+	}
+}
+
+// Prune drops the entries not seen since cutoff, and returns how many.
+func (l KnownBadList) Prune(cutoff time.Time) int {
+	pruned := 0
+
+	for hash, entry := range l {
+		if entry.LastSeen.Before(cutoff) {
+			delete(l, hash)
+
+			pruned += 1
+		}
+	}
+
+	return pruned
+}
+
+// Filter drops jobs whose content failed the same way KnownBadAttempts times.
+// Only files with the size of a known-bad entry are hashed.
+func (l KnownBadList) Filter(jobs []*Job) ([]*Job, []string) {
+	sizes := map[int64]bool{}
+
+	for _, entry := range l {
+		if entry.Attempts >= KnownBadAttempts {
+			sizes[entry.Size] = true
+		}
+	}
+
+	if len(sizes) == 0 {
+		return jobs, nil
+	}
+
+	var skipped []string
+
+	filtered := jobs[:0]
+
+	for _, job := range jobs {
+		if info, err := os.Stat(job.Path); err == nil && sizes[info.Size()] {
+			hash, err := HashFile(job.Path)
+
+			if entry := l[hash]; err == nil && entry != nil && entry.Attempts >= KnownBadAttempts {
+				skipped = append(skipped, job.Path)
+
+				continue
+			}
+		}
+
+		filtered = append(filtered, job)
+	}
+
+	return filtered, skipped
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/sys/unix"
+)
+
+func LoadAverage() (float64, error) {
+	// struct loadavg { fixpt_t ldavg[3]; long fscale; }
+	data, err := unix.SysctlRaw("vm.loadavg")
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(data) < 24 {
+		return 0, ErrNoLoadAverage
+	}
+
+	load := binary.LittleEndian.Uint32(data[0:4])
+	scale := binary.LittleEndian.Uint64(data[16:24])
+
+	if scale == 0 {
+		return 0, ErrNoLoadAverage
+	}
+
+	return float64(load) / float64(scale), nil
+}
+
+func CPUTemperature() (float64, error) {
+	return 0, ErrNoTemperature
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func LoadAverage() (float64, error) {
+	data, err := os.ReadFile("/proc/loadavg")
+
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(data))
+
+	if len(fields) == 0 {
+		return 0, ErrNoLoadAverage
+	}
+
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// CPUTemperature is the hottest thermal zone, in degrees Celsius.
+func CPUTemperature() (float64, error) {
+	zones, err := filepath.Glob("/sys/class/thermal/thermal_zone*/temp")
+
+	if err != nil {
+		return 0, err
+	}
+
+	hottest, found := 0.0, false
+
+	for _, zone := range zones {
+		data, err := os.ReadFile(zone)
+
+		if err != nil {
+			continue
+		}
+
+		millidegrees, err := strconv.Atoi(strings.TrimSpace(string(data)))
+
+		if err != nil {
+			continue
+		}
+
+		hottest = max(hottest, float64(millidegrees)/1000)
+		found = true
+	}
+
+	if !found {
+		return 0, ErrNoTemperature
+	}
+
+	return hottest, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+func LoadAverage() (float64, error) {
+	return 0, ErrNoLoadAverage
+}
+
+func CPUTemperature() (float64, error) {
+	return 0, ErrNoTemperature
+}
@@ -2,27 +2,36 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/demiazz/avify/convert"
+	"github.com/demiazz/avify/internal/vips"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
-	"golang.org/x/sync/semaphore"
 )
 
 // region Variables
 
 const Version = "0.1"
 
-const AllowedExtensions = `\.(gif|jpg|jpeg|png|webp)$`
+const AllowedExtensions = `\.(gif|jpg|jpeg|png|webp|ico)$`
 
 var AvifExportParams = &vips.AvifExportParams{
 	Effort:        5,
@@ -31,24 +40,37 @@ var AvifExportParams = &vips.AvifExportParams{
 	StripMetadata: false,
 }
 
+var AvifBrand = ""
+
 var Concurrency = runtime.NumCPU()
 
-var Progress = progressbar.NewOptions(0,
-	progressbar.OptionEnableColorCodes(true),
-	progressbar.OptionSetElapsedTime(true),
-	progressbar.OptionSetPredictTime(false),
-	progressbar.OptionSetTheme(progressbar.Theme{
-		Saucer:        "[cyan]=[reset]",
-		SaucerHead:    "[cyan]>[reset]",
-		SaucerPadding: " ",
-		BarStart:      "[",
-		BarEnd:        "]",
-	}),
-	progressbar.OptionShowBytes(false),
-	progressbar.OptionShowCount(),
-	progressbar.OptionShowElapsedTimeOnFinish(),
-	progressbar.OptionSpinnerType(14),
-)
+var UseSyslog = false
+
+var KeepOriginals = false
+
+// Deterministic trades the threads libvips uses inside one image for outputs
+// that are byte-identical between runs; images still convert in parallel.
+var Deterministic = false
+
+var CASDir = ""
+
+var CheckBanding = false
+
+var BandingThreshold = 0.5
+
+var ReportPath = ""
+
+var OrganizeByDate = ""
+
+var RecycleEvery = 0
+
+var ManifestHashes = false
+
+var CollisionPolicy = CollisionSuffix
+
+var ConsoleANSI = EnableConsoleANSI()
+
+var Progress = NewProgress(ConsoleANSI)
 
 // endregion Variables
 
@@ -57,26 +79,58 @@ var Progress = progressbar.NewOptions(0,
 type Reader struct {
 	r     io.Reader
 	count int64
+	hash  hash.Hash
 }
 
 func NewReader(r io.Reader) *Reader {
 	return &Reader{r: r}
 }
 
+func NewHashingReader(r io.Reader) *Reader {
+	return &Reader{r: r, hash: sha256.New()}
+}
+
 func (r *Reader) Read(p []byte) (n int, err error) {
 	n, err = r.r.Read(p)
 
 	r.count += int64(n)
 
+	if r.hash != nil {
+		r.hash.Write(p[:n])
+	}
+
 	return n, err
 }
 
+func (r *Reader) Sum() string {
+	if r.hash == nil {
+		return ""
+	}
+
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
 func ReplaceExt(path string) string {
 	old := filepath.Ext(path)
 
 	return strings.TrimSuffix(path, old) + ".avif"
 }
 
+func SourceFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return "JPEG"
+	case ".png":
+		return "PNG"
+	case ".gif":
+		return "GIF"
+	case ".webp":
+		return "WebP"
+	}
+
+	return strings.ToUpper(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
 func FormatBytes(bytes uint64) string {
 	const unit = 1024
 
@@ -96,211 +150,1609 @@ func FormatBytes(bytes uint64) string {
 	return fmt.Sprintf("%.1f%s", float64(bytes)/float64(div), suffixes[exp])
 }
 
+// FormatSaving formats how much smaller after is than before. Outputs that
+// grew are a negative saving.
+func FormatSaving(before, after uint64) string {
+	if after > before {
+		return "-" + FormatBytes(after-before)
+	}
+
+	return FormatBytes(before - after)
+}
+
+func NewProgress(ansi bool) *progressbar.ProgressBar {
+	if !ansi {
+		return progressbar.NewOptions(0,
+			progressbar.OptionEnableColorCodes(false),
+			progressbar.OptionUseANSICodes(false),
+			progressbar.OptionSetElapsedTime(true),
+			progressbar.OptionSetPredictTime(false),
+			progressbar.OptionSetTheme(progressbar.Theme{
+				Saucer:        "=",
+				SaucerHead:    ">",
+				SaucerPadding: " ",
+				BarStart:      "[",
+				BarEnd:        "]",
+			}),
+			progressbar.OptionShowBytes(false),
+			progressbar.OptionShowCount(),
+			progressbar.OptionShowElapsedTimeOnFinish(),
+			progressbar.OptionSpinnerType(9),
+		)
+	}
+
+	return progressbar.NewOptions(0,
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionSetElapsedTime(true),
+		progressbar.OptionSetPredictTime(false),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[cyan]=[reset]",
+			SaucerHead:    "[cyan]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}),
+		progressbar.OptionShowBytes(false),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowElapsedTimeOnFinish(),
+		progressbar.OptionSpinnerType(14),
+	)
+}
+
+func Highlight(text string) string {
+	if !ConsoleANSI {
+		return text
+	}
+
+	return "[cyan]" + text + "[reset]"
+}
+
 // endregion Helpers
 
 // region Traverse
 
-func FindImagesAt(root string) ([]string, error) {
-	r, err := regexp.Compile(AllowedExtensions)
+type SkipReason string
+
+const (
+	SkipExtension    SkipReason = "extension excluded"
+	SkipFormat       SkipReason = "format excluded by " + RCFileName + " or " + TOMLFileName
+	SkipIrregular    SkipReason = "not a regular file"
+	SkipReadOnly     SkipReason = "read-only directory"
+	SkipSettings     SkipReason = "directory skipped by " + RCFileName + " or " + TOMLFileName
+	SkipEmpty        SkipReason = "empty file"
+	SkipTruncated    SkipReason = "truncated image"
+	SkipVariant      SkipReason = "edited variant not imported"
+	SkipOriginal     SkipReason = "original of an edited variant not imported"
+	SkipKnownFailure SkipReason = "known to fail"
+	SkipMissing      SkipReason = "source missing"
+	SkipNotInReport  SkipReason = "not in report subset"
+	SkipMarked       SkipReason = "no gain with the same settings"
+	SkipHEIC         SkipReason = "HEIC kept, re-encoding loses quality"
+	SkipHEVC         SkipReason = "HEVC coded HEIC kept, can't be repackaged"
+	SkipExcluded     SkipReason = "excluded by --exclude"
+	SkipNotIncluded  SkipReason = "not matching --include"
+	SkipNotMatched   SkipReason = "not matching the glob"
+	SkipManifest     SkipReason = "already converted (" + ManifestName + ")"
+	SkipIgnored      SkipReason = "ignored by " + IgnoreFileName + " or " + GitIgnoreFileName
+	SkipSVG          SkipReason = "SVG kept, --svg to rasterize"
+	SkipOutsideRoots SkipReason = "outside the given directories"
+)
 
-	if err != nil {
-		return nil, err
+type Job struct {
+	Root   string
+	Path   string
+	Output string
+	Params *vips.AvifExportParams
+	Error  error
+
+	// Repackage marks AV1 coded HEIF files that are turned into AVIF without
+	// decoding them.
+	Repackage bool
+
+	span *Span
+
+	mu        sync.Mutex
+	expired   bool
+	committed bool
+}
+
+// ExportParams are the parameters of the job before size classes apply.
+func (j *Job) ExportParams() *vips.AvifExportParams {
+	if j.Params == nil {
+		return AvifExportParams
+	}
+
+	return j.Params
+}
+
+type Discovery struct {
+	Jobs      []*Job
+	ReadOnly  []string
+	Truncated []string
+	Skipped   map[SkipReason]int
+	Histogram *Histogram
+
+	// SkippedPaths are only recorded for --dry-run.
+	SkippedPaths map[SkipReason][]string
+
+	observer convert.Observer
+}
+
+func (d *Discovery) Skip(reason SkipReason, path string) {
+	d.Skipped[reason] += 1
+
+	if DryRun {
+		if d.SkippedPaths == nil {
+			d.SkippedPaths = map[SkipReason][]string{}
+		}
+
+		d.SkippedPaths[reason] = append(d.SkippedPaths[reason], path)
 	}
+}
 
-	Progress.ChangeMax(-1)
-	Progress.Describe("[cyan]Search images...[reset]")
+func (d *Discovery) Merge(other *Discovery) {
+	d.Jobs = append(d.Jobs, other.Jobs...)
+	d.ReadOnly = append(d.ReadOnly, other.ReadOnly...)
+	d.Truncated = append(d.Truncated, other.Truncated...)
 
-	defer Progress.Exit()
+	for reason, count := range other.Skipped {
+		d.Skipped[reason] += count
+	}
 
-	var files []string
+	for reason, paths := range other.SkippedPaths {
+		if d.SkippedPaths == nil {
+			d.SkippedPaths = map[SkipReason][]string{}
+		}
 
-	var count int
+		d.SkippedPaths[reason] = append(d.SkippedPaths[reason], paths...)
+	}
 
-	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
+	if other.Histogram != nil {
+		if d.Histogram == nil {
+			d.Histogram = NewHistogram()
 		}
 
-		if !d.Type().IsRegular() {
+		d.Histogram.Merge(other.Histogram)
+	}
+}
+
+func (d *Discovery) PrintSkipped() {
+	if len(d.Skipped) == 0 {
+		return
+	}
+
+	fmt.Println("Skipped:")
+
+	for _, reason := range slices.Sorted(maps.Keys(d.Skipped)) {
+		fmt.Printf("\t%s: %d\n", reason, d.Skipped[reason])
+
+		for _, path := range d.SkippedPaths[reason] {
+			fmt.Printf("\t\t%s\n", path)
+		}
+	}
+
+	if d.SkippedPaths != nil {
+		return
+	}
+
+	if len(d.ReadOnly) > 0 {
+		fmt.Println("Following directories are read-only:")
+
+		for _, path := range d.ReadOnly {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+
+	if len(d.Truncated) > 0 {
+		fmt.Println("Following files are empty or truncated:")
+
+		for _, path := range d.Truncated {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+}
+
+// Admit runs the checks every discovered file goes through, and adds the job
+// unless one of them skips the file. stat is only called for image files.
+func (d *Discovery) Admit(r *regexp.Regexp, job *Job, stat func() (fs.FileInfo, error)) error {
+	path := job.Path
+
+	if !MatchesGlobs(job.Root, path) {
+		d.Skip(SkipNotMatched, path)
+
+		return nil
+	}
+
+	if !HasWantedExtension(path) {
+		d.Skip(SkipExtension, path)
+
+		return nil
+	}
+
+	if !IsIncluded(path) {
+		d.Skip(SkipNotIncluded, path)
+
+		return nil
+	}
+
+	if IsSVG(path) {
+		if !RasterizeSVG {
+			d.Skip(SkipSVG, path)
+
 			return nil
 		}
+	} else if IsHEIF(path) {
+		switch HEICPolicy {
+		case HEICSkip:
+			d.Skip(SkipHEIC, path)
 
-		if matched := r.MatchString(path); matched {
-			count += 1
+			return nil
+		case HEICRepackage:
+			coding, err := HEIFCoding(path)
 
-			if count >= 20 {
-				Progress.Add(count)
+			if err != nil || coding != "av01" {
+				d.Skip(SkipHEVC, path)
 
-				count = 0
+				return nil
 			}
 
-			files = append(files, path)
+			job.Repackage = true
 		}
+	} else if matched := r.MatchString(path); !matched {
+		d.Skip(SkipExtension, path)
+
+		return nil
+	}
+
+	info, err := stat()
+
+	if err != nil {
+		return err
+	}
+
+	if info.Size() == 0 {
+		d.Truncated = append(d.Truncated, path)
+		d.Skip(SkipEmpty, path)
+
+		return nil
+	}
+
+	truncated, err := IsTruncated(path, info.Size())
+
+	if err != nil {
+		return err
+	}
+
+	if truncated {
+		d.Truncated = append(d.Truncated, path)
+		d.Skip(SkipTruncated, path)
+
+		return nil
+	}
+
+	if UseXattrs && IsMarkedSkipped(path, job.ExportParams()) {
+		d.Skip(SkipMarked, path)
 
 		return nil
+	}
+
+	d.Jobs = append(d.Jobs, job)
+
+	if d.Histogram != nil {
+		d.Histogram.Add(path)
+	}
+
+	if d.observer != nil {
+		d.observer.OnDiscovered(job.File())
+	}
+
+	return nil
+}
+
+func FindImagesAt(root string) (*Discovery, error) {
+	return WalkImages(root, RunObserver)
+}
+
+// WalkImages finds the images under root like FindImagesAt, but reports them
+// to observer instead of the one of the run.
+func WalkImages(root string, observer convert.Observer) (*Discovery, error) {
+	admission, err := NewAdmission(root, observer)
+
+	if err != nil {
+		return nil, err
+	}
+
+	observer.OnPhase(convert.PhaseDiscovery, -1)
+
+	defer observer.OnPhase(convert.PhaseDone, 0)
+
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return admission.AdmitFile(path, d.Type(), d.Info)
+		}
+
+		reason, err := admission.EnterDir(path)
+
+		if err != nil || reason == "" {
+			return err
+		}
+
+		admission.Discovery.Skip(reason, path)
+
+		return fs.SkipDir
 	})
 
-	return files, err
+	return admission.Discovery, err
 }
 
 // endregion Traverse
 
 // region Convert
 
-func ConvertImage(path string) (uint64, uint64, error) {
+type Result struct {
+	Path       string  `json:"path"`
+	Output     string  `json:"output,omitempty"`
+	Format     string  `json:"format"`
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	Warning    string  `json:"warning,omitempty"`
+	SizeBefore uint64  `json:"size_before"`
+	SizeAfter  uint64  `json:"size_after"`
+	Banding    float64 `json:"banding,omitempty"`
+	Protected  bool    `json:"protected,omitempty"`
+	Replaced   bool    `json:"replaced,omitempty"`
+	Camera     string  `json:"camera,omitempty"`
+	Year       int     `json:"year,omitempty"`
+	Sidecar    string  `json:"sidecar,omitempty"`
+	Retried    bool    `json:"retried,omitempty"`
+	Quality    int     `json:"quality,omitempty"`
+	SourceHash string  `json:"source_sha256,omitempty"`
+	OutputHash string  `json:"output_sha256,omitempty"`
+
+	verification time.Duration
+}
+
+const (
+	StatusConverted = "converted"
+	StatusFailed    = "failed"
+	StatusNoGain    = "no-gain"
+)
+
+func ConvertImage(job *Job) (*Result, error) {
+	path := job.Path
+
+	if job.Error != nil {
+		return nil, job.Error
+	}
+
+	if job.Repackage {
+		return RepackageHEIF(job)
+	}
+
 	file, err := os.Open(path)
 
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
 	defer file.Close()
 
 	reader := NewReader(file)
 
-	image, err := vips.NewImageFromReader(reader)
+	if ManifestHashes {
+		reader = NewHashingReader(file)
+	}
+
+	span := StartSpan(job.span, "decode")
+
+	image, err := ImageDecoder.Decode(reader)
+
+	span.End(err)
 
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
-	bytes, _, err := image.ExportAvif(AvifExportParams)
+	result := &Result{Path: path, Output: OutputPath(job, image), Format: SourceFormat(path), Protected: IsProtected(path, image)}
 
-	if err != nil {
-		return 0, 0, err
+	result.Camera = CameraModel(image)
+
+	if t, ok := ExifCaptureTime(image); ok {
+		result.Year = t.Year()
 	}
 
-	err = os.WriteFile(ReplaceExt(path), bytes, 0644)
+	params := budget.Params(SizeClassParams(job.ExportParams(), image.Width(), image.Height()))
 
-	if err != nil {
-		return 0, 0, err
+	if ref, ok := image.(*vips.ImageRef); ok && ImportProfile != "" {
+		xmp, err := ImportXMP(path)
+
+		if err != nil {
+			image.Close()
+
+			return nil, err
+		}
+
+		if len(xmp) > 0 {
+			ref.SetBlob("xmp-data", MergeXMP(ref.GetBlob("xmp-data"), xmp))
+		}
 	}
 
-	err = os.Remove(path)
+	if ref, ok := image.(*vips.ImageRef); ok {
+		if err := PrepareAlpha(ref); err != nil {
+			image.Close()
 
-	if err != nil {
-		return 0, 0, err
+			return nil, err
+		}
 	}
 
-	return uint64(reader.count), uint64(len(bytes)), nil
-}
+	if ref, ok := image.(*vips.ImageRef); ok && EmbedICC != "" {
+		if err := ref.TransformICCProfile(EmbedICC); err != nil {
+			image.Close()
 
-type Stats struct {
-	Failed []string
+			return nil, err
+		}
+	}
 
-	SizeBefore uint64
-	SizeAfter  uint64
-}
+	var bytes []byte
 
-func ConvertImages(paths []string) *Stats {
-	Progress.Reset()
-	Progress.ChangeMax(len(paths))
-	Progress.Describe("[cyan]Converting images...[reset]")
+	span = StartSpan(job.span, "encode", "quality", strconv.Itoa(params.Quality), "effort", strconv.Itoa(params.Effort))
 
-	defer func() {
-		Progress.Exit()
+	if ref, ok := image.(*vips.ImageRef); ok && TargetSSIM > 0 {
+		bytes, result.Quality, err = SearchQuality(ref, params)
+	} else {
+		bytes, err = ImageEncoder.Encode(image, params)
+	}
 
-		fmt.Println()
-	}()
+	span.End(err)
 
-	stats := &Stats{}
+	if err == nil && CheckBanding {
+		if ref, ok := image.(*vips.ImageRef); ok {
+			started := time.Now()
+			span := StartSpan(job.span, "verify")
 
-	wg := sync.WaitGroup{}
-	mu := sync.Mutex{}
-	sm := semaphore.NewWeighted(int64(Concurrency))
+			var verifyErr error
 
-	for _, path := range paths {
-		wg.Add(1)
+			result.Banding, verifyErr = MeasureBanding(ref, bytes)
+			result.verification = time.Since(started)
 
-		sm.Acquire(context.TODO(), 1)
+			span.End(verifyErr)
 
-		go func(path string) {
-			defer wg.Done()
-			defer sm.Release(1)
+			// The output is fine, it just couldn't be checked.
+			if verifyErr != nil {
+				result.Warning = fmt.Sprintf("banding not checked: %v", verifyErr)
+			}
+		}
+	}
 
-			sizeBefore, sizeAfter, err := ConvertImage(path)
+	var exif []byte
 
-			mu.Lock()
+	if ExifSidecar {
+		exif = MakerNoteExif(image)
+	}
 
-			Progress.Add(1)
+	image.Close()
 
-			if err != nil {
-				stats.Failed = append(stats.Failed, path)
-			} else {
-				stats.SizeBefore += sizeBefore
-				stats.SizeAfter += sizeAfter
-			}
+	if err != nil {
+		return nil, err
+	}
+
+	result.SizeBefore = uint64(reader.count)
+	result.SizeAfter = uint64(len(bytes))
+
+	// SVGs are rasterized as fallbacks, which are larger more often than not.
+	if !HasGain(result.SizeBefore, result.SizeAfter) && !IsSVG(path) {
+		result.Status = StatusNoGain
+
+		if UseXattrs && !ReadOnlySource {
+			MarkSkipped(path, StatusNoGain, job.ExportParams())
+		}
 
-			mu.Unlock()
-		}(path)
+		return result, nil
 	}
 
-	wg.Wait()
+	if ManifestHashes {
+		sum := sha256.Sum256(bytes)
 
-	return stats
-}
+		result.SourceHash = reader.Sum()
+		result.OutputHash = hex.EncodeToString(sum[:])
+	}
 
-// endregion Convert
+	if err := job.Commit(); err != nil {
+		return nil, err
+	}
 
-func main() {
-	vips.LoggingSettings(nil, vips.LogLevelError)
+	span = StartSpan(job.span, "write", "output", result.Output)
 
-	vips.Startup(&vips.Config{
-		ConcurrencyLevel: Concurrency,
-		MaxCacheMem:      0,
-		MaxCacheSize:     0,
-		MaxCacheFiles:    0,
-		CacheTrace:       false,
-	})
+	err = ImageSink.Write(result.Output, bytes)
 
-	defer vips.Shutdown()
+	span.End(err)
 
-	rootCmd := &cobra.Command{
-		Use:   "avify",
-		Short: "Avify allows to convert your reference images to AVIF format to save your storage space",
-		Args:  cobra.MinimumNArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
-			paths, err := FindImagesAt(args[0])
+	if err != nil {
+		return nil, err
+	}
 
-			if err != nil {
-				panic(err)
-			}
+	if _, ok := ImageSink.(FileSink); ok && UseXattrs {
+		MarkOutput(result.Output, job.ExportParams())
+	}
 
-			if len(paths) == 0 {
-				fmt.Println("No images found")
+	if len(exif) > 0 {
+		result.Sidecar = result.Output + ExifSidecarExt
 
-				return
-			}
+		if err := ImageSink.Write(result.Sidecar, exif); err != nil {
+			return nil, err
+		}
+	}
 
-			stats := ConvertImages(paths)
+	if !KeepOriginals && !result.Protected && !(KeepICO && IsICOPath(path)) && !IsSVG(path) {
+		if err := ReplaceOriginal(job, result.Output, reader.count); err != nil {
+			return nil, err
+		}
 
-			if len(stats.Failed) < len(paths) {
-				savedSize := stats.SizeBefore - stats.SizeAfter
-				saved := float64(savedSize) / float64(stats.SizeBefore) * 100
+		result.Replaced = true
+	}
 
-				fmt.Printf("Total size before: %s\n", FormatBytes(stats.SizeBefore))
-				fmt.Printf("Total size after: %s\n", FormatBytes(stats.SizeAfter))
-				fmt.Printf("Saved size: %s (%.2f%%)\n", FormatBytes(savedSize), saved)
-			}
+	return result, nil
+}
 
-			if len(stats.Failed) > 0 {
-				fmt.Println("Following files are failed:")
+// ReplaceOriginal deletes the source of a job once its output is written,
+// journaling the deletion so an interrupted run can be finished by clean.
+func ReplaceOriginal(job *Job, output string, size int64) error {
+	if err := Journal(job.Root, JournalDelete, job.Path, output); err != nil {
+		return err
+	}
 
-				for _, path := range stats.Failed {
-					fmt.Printf("\t%s\n", path)
-				}
-			}
-		},
+	if err := RecordReplaced(job.Path); err != nil {
+		return err
 	}
 
-	rootCmd.AddCommand(&cobra.Command{
-		Use: "version",
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Printf("avify %s (%s, vips %v)\n", Version, runtime.Version(), vips.Version)
-		},
-	})
+	if err := Audit(AuditDelete, job.Path, "replacement", output, "size", strconv.FormatInt(size, 10)); err != nil {
+		return err
+	}
+
+	if err := ImageSink.Remove(job.Path); err != nil {
+		return err
+	}
+
+	return Journal(job.Root, JournalDeleted, job.Path, output)
+}
+
+type FormatStats struct {
+	Count  int     `json:"count"`
+	Failed int     `json:"failed"`
+	Ratios float64 `json:"-"`
+
+	SizeBefore uint64 `json:"size_before"`
+	SizeAfter  uint64 `json:"size_after"`
+}
+
+func (s *FormatStats) AverageRatio() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+
+	return s.Ratios / float64(s.Count)
+}
+
+func (s *FormatStats) Add(result *Result) {
+	s.Count += 1
+	s.SizeBefore += result.SizeBefore
+	s.SizeAfter += result.SizeAfter
+
+	if result.SizeBefore > 0 {
+		s.Ratios += float64(result.SizeAfter) / float64(result.SizeBefore)
+	}
+}
+
+func (s *FormatStats) MarshalJSON() ([]byte, error) {
+	type plain FormatStats
+
+	return json.Marshal(struct {
+		*plain
+		AverageRatio float64 `json:"average_ratio"`
+	}{(*plain)(s), s.AverageRatio()})
+}
+
+// UnmarshalJSON takes the ratios back from the average, so stats read from
+// a report add up with others.
+func (s *FormatStats) UnmarshalJSON(data []byte) error {
+	type plain FormatStats
+
+	decoded := struct {
+		*plain
+		AverageRatio float64 `json:"average_ratio"`
+	}{plain: (*plain)(s)}
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	s.Ratios = decoded.AverageRatio * float64(s.Count)
+
+	return nil
+}
+
+type Stats struct {
+	Results   []*Result
+	Failed    []string
+	NoGain    []string
+	Banding   []string
+	Protected []string
+	Formats   map[string]*FormatStats
+	Roots     map[string]*FormatStats
+	Timings   Timings
+
+	// Replaced counts outputs whose original was deleted, Added those
+	// written next to a kept original, which take extra space.
+	Replaced FormatStats
+	Added    FormatStats
+
+	// Cameras and Years group converted files by EXIF camera model and
+	// capture year, to tell which parts of an archive deserve a redo.
+	Cameras map[string]*FormatStats
+	Years   map[string]*FormatStats
+
+	// Trees holds the --tree-checksum digests of every root.
+	Trees map[string]*TreeChecksums
+
+	SizeBefore uint64
+	SizeAfter  uint64
+}
+
+func (s *Stats) Format(format string) *FormatStats {
+	if s.Formats[format] == nil {
+		s.Formats[format] = &FormatStats{}
+	}
+
+	return s.Formats[format]
+}
+
+func (s *Stats) Root(root string) *FormatStats {
+	if s.Roots[root] == nil {
+		s.Roots[root] = &FormatStats{}
+	}
+
+	return s.Roots[root]
+}
+
+// AddConverted counts a converted result in the totals.
+func (s *Stats) AddConverted(result *Result) {
+	s.SizeBefore += result.SizeBefore
+	s.SizeAfter += result.SizeAfter
+
+	if result.Replaced {
+		s.Replaced.Add(result)
+	} else {
+		s.Added.Add(result)
+	}
+
+	camera, year := result.Camera, UnknownGroup
+
+	if camera == "" {
+		camera = UnknownGroup
+	}
+
+	if result.Year > 0 {
+		year = strconv.Itoa(result.Year)
+	}
+
+	s.Cameras = addToGroup(s.Cameras, camera, result)
+	s.Years = addToGroup(s.Years, year, result)
+}
+
+const UnknownGroup = "unknown"
+
+func addToGroup(groups map[string]*FormatStats, key string, result *Result) map[string]*FormatStats {
+	if groups == nil {
+		groups = map[string]*FormatStats{}
+	}
+
+	if groups[key] == nil {
+		groups[key] = &FormatStats{}
+	}
+
+	groups[key].Add(result)
+
+	return groups
+}
+
+// PrintGroups prints the savings by camera and by capture year.
+func (s *Stats) PrintGroups() {
+	for _, group := range []struct {
+		title  string
+		groups map[string]*FormatStats
+	}{{"By camera:", s.Cameras}, {"By capture year:", s.Years}} {
+		if len(group.groups) == 0 {
+			continue
+		}
+
+		fmt.Println(group.title)
+
+		for _, key := range slices.Sorted(maps.Keys(group.groups)) {
+			g := group.groups[key]
+
+			fmt.Printf("\t%s: %d converted, %s -> %s (saved %s)\n", key, g.Count, FormatBytes(g.SizeBefore), FormatBytes(g.SizeAfter), FormatSaving(g.SizeBefore, g.SizeAfter))
+		}
+	}
+}
+
+// NetChange is how much disk space the run took (positive) or freed
+// (negative): all outputs were added, only replaced originals were removed.
+func (s *Stats) NetChange() string {
+	if s.SizeAfter >= s.Replaced.SizeBefore {
+		return "+" + FormatBytes(s.SizeAfter-s.Replaced.SizeBefore)
+	}
+
+	return "-" + FormatBytes(s.Replaced.SizeBefore-s.SizeAfter)
+}
+
+func (s *Stats) PrintRoots() {
+	if len(s.Roots) < 2 {
+		return
+	}
+
+	fmt.Println("By root:")
+
+	for _, root := range slices.Sorted(maps.Keys(s.Roots)) {
+		r := s.Roots[root]
+
+		fmt.Printf("	%s: %d converted, %d failed, %s -> %s (saved %s)\n",
+			root, r.Count, r.Failed, FormatBytes(r.SizeBefore), FormatBytes(r.SizeAfter), FormatSaving(r.SizeBefore, r.SizeAfter))
+	}
+}
+
+func (s *Stats) PrintFormats() {
+	if len(s.Formats) == 0 {
+		return
+	}
+
+	fmt.Println("By format:")
+
+	for _, format := range slices.Sorted(maps.Keys(s.Formats)) {
+		f := s.Formats[format]
+
+		fmt.Printf("\t%s: %d converted, %d failed, %s -> %s (average ratio %.2f%%)\n",
+			format, f.Count, f.Failed, FormatBytes(f.SizeBefore), FormatBytes(f.SizeAfter), f.AverageRatio()*100)
+	}
+}
+
+func (s *Stats) PrintSummary() {
+	if len(s.Failed)+len(s.NoGain) < len(s.Results) {
+		saved := (float64(s.SizeBefore) - float64(s.SizeAfter)) / float64(s.SizeBefore) * 100
+
+		fmt.Printf("Total size before: %s\n", FormatBytes(s.SizeBefore))
+		fmt.Printf("Total size after: %s\n", FormatBytes(s.SizeAfter))
+		fmt.Printf("Saved size: %s (%.2f%%)\n", FormatSaving(s.SizeBefore, s.SizeAfter), saved)
+
+		if s.Added.Count > 0 {
+			fmt.Printf("Replaced originals: %d, %s -> %s\n", s.Replaced.Count, FormatBytes(s.Replaced.SizeBefore), FormatBytes(s.Replaced.SizeAfter))
+			fmt.Printf("Added next to kept originals: %d, %s\n", s.Added.Count, FormatBytes(s.Added.SizeAfter))
+			fmt.Printf("Net disk change: %s\n", s.NetChange())
+		}
+
+		s.PrintRoots()
+		s.PrintFormats()
+	}
+
+	if budget != nil && budget.Offset() != 0 {
+		fmt.Printf("Effort shifted by %+d to fit the time budget\n", budget.Offset())
+	}
+
+	if len(s.Failed) > 0 {
+		fmt.Println("Following files are failed:")
+
+		for _, path := range s.Failed {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+
+	if len(s.NoGain) > 0 {
+		fmt.Printf("Following files are skipped (no gain), their AVIF saves less than %s:\n", MinSavings.String())
+
+		for _, path := range s.NoGain {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+
+	if len(s.Protected) > 0 {
+		fmt.Println("Following originals are protected and kept:")
+
+		for _, path := range s.Protected {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+
+	if len(s.Banding) > 0 {
+		fmt.Println("Following files may show visible banding:")
+
+		for _, path := range s.Banding {
+			fmt.Printf("\t%s\n", path)
+		}
+	}
+
+	var warned []*Result
+
+	for _, result := range s.Results {
+		if result.Warning != "" {
+			warned = append(warned, result)
+		}
+	}
+
+	if len(warned) > 0 {
+		fmt.Println("Following files have warnings:")
+
+		for _, result := range warned {
+			fmt.Printf("\t%s: %s\n", result.Path, result.Warning)
+		}
+	}
+}
+
+func ConvertImages(ctx context.Context, jobs []*Job) *Stats {
+	RunObserver.OnPhase(convert.PhaseConversion, len(jobs))
+
+	defer RunObserver.OnPhase(convert.PhaseDone, 0)
+
+	stats := &Stats{Formats: map[string]*FormatStats{}, Roots: map[string]*FormatStats{}}
+
+	started := time.Now()
+
+	defer func() {
+		stats.Timings.Conversion = time.Since(started)
+	}()
+
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	sm := NewWorkers(Concurrency)
+	running := map[*Job]time.Time{}
+
+	if TimeBudget > 0 {
+		budget = NewBudget(TimeBudget, len(jobs), Concurrency)
+	}
+
+	defer sm.Stop()
+	defer AdjustWorkers(sm)()
+	defer Throttle(sm)()
+
+	if ProgressFile != "" {
+		stop := StartProgressFile(ProgressFile, func() *ProgressState {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return &ProgressState{Total: len(jobs), Done: len(stats.Results), Failed: len(stats.Failed), Workers: sm.Limit()}
+		})
+
+		defer stop()
+	}
+
+	defer ReportStatus(func() *RunStatus {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return &RunStatus{Started: started, Total: len(jobs), Done: len(stats.Results), Failed: len(stats.Failed), Workers: sm.Limit(), Running: maps.Clone(running)}
+	})()
+
+	convertJob := func(job *Job) {
+		path := job.Path
+
+		mu.Lock()
+		running[job] = time.Now()
+		RunObserver.OnStart(job.File())
+		mu.Unlock()
+
+		job.span = StartSpan(TraceRoot, "convert", "path", path)
+
+		result, err := ConvertWithRetry(job)
+
+		job.span.End(err)
+
+		budget.Complete()
+
+		mu.Lock()
+
+		delete(running, job)
+
+		if err != nil {
+			RunObserver.OnError(job.File(), err)
+
+			LogFailure(path, err)
+
+			stats.Failed = append(stats.Failed, path)
+			stats.Results = append(stats.Results, &Result{Path: path, Format: SourceFormat(path), Status: StatusFailed, Error: err.Error()})
+
+			PrintRecord0(StatusFailed, path)
+			stats.Format(SourceFormat(path)).Failed += 1
+			stats.Root(job.Root).Failed += 1
+		} else if result.Status == StatusNoGain {
+			stats.NoGain = append(stats.NoGain, path)
+			stats.Results = append(stats.Results, result)
+
+			PrintRecord0(result.Status, path)
+
+			RunObserver.OnSkip(job.File(), result.Observed())
+		} else {
+			result.Status = StatusConverted
+
+			stats.Results = append(stats.Results, result)
+			stats.Timings.Verification += result.verification
+			stats.AddConverted(result)
+
+			stats.Format(result.Format).Add(result)
+			stats.Root(job.Root).Add(result)
+
+			if CheckBanding && result.Banding >= BandingThreshold {
+				stats.Banding = append(stats.Banding, path)
+			}
+
+			if result.Protected {
+				stats.Protected = append(stats.Protected, path)
+			}
+
+			PrintRecord0(result.Status, path)
+
+			RunObserver.OnComplete(job.File(), result.Observed())
+		}
+
+		RunCheckpoint.Record(stats.Results[len(stats.Results)-1])
+
+		recycle := RecycleEvery > 0 && len(stats.Results)%RecycleEvery == 0
+
+		mu.Unlock()
+
+		if recycle {
+			Recycle()
+		}
+	}
+
+	for _, batch := range BatchJobs(jobs, Concurrency) {
+		if err := WaitForPower(ctx); err != nil {
+			fmt.Printf("Failed to read power status: %v\n", err)
+
+			PauseOnBattery, MinBattery = false, 0
+		}
+
+		if err := sm.Acquire(ctx, 1); err != nil {
+			break
+		}
+
+		wg.Add(1)
+
+		go func(batch []*Job) {
+			defer wg.Done()
+			defer sm.Release(1)
+
+			for _, job := range batch {
+				if ctx.Err() != nil {
+					return
+				}
+
+				convertJob(job)
+			}
+		}(batch)
+	}
+
+	wg.Wait()
+
+	RunObserver.OnSummary(stats.Summary())
+
+	return stats
+}
+
+func Recycle() {
+	vips.ClearCache()
+
+	debug.FreeOSMemory()
+}
+
+// endregion Convert
+
+func NewRootCmd() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:   "avify DIR...",
+		Short: "Avify allows to convert your reference images to AVIF format to save your storage space",
+		Args:  cobra.ArbitraryArgs,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			NotifyStatus()
+			NotifyWorkers()
+
+			if err := ApplyEnv(cmd.Flags(), cmd.Root().Flags(), cmd.Root().PersistentFlags()); err != nil {
+				return err
+			}
+
+			if err := ApplyConfig(cmd.Flags(), cmd.Root().Flags(), cmd.Root().PersistentFlags()); err != nil {
+				return err
+			}
+
+			if err := ApplyProfile(cmd.Flags()); err != nil {
+				return err
+			}
+
+			if AvifBrand != "" && len(AvifBrand) != 4 {
+				return fmt.Errorf("brand %q must be exactly four characters", AvifBrand)
+			}
+
+			if CollisionPolicy != CollisionSuffix && CollisionPolicy != CollisionFail {
+				return fmt.Errorf("unknown collision policy %q", CollisionPolicy)
+			}
+
+			if AvifExportParams.Quality < 1 || AvifExportParams.Quality > 100 {
+				return fmt.Errorf("invalid quality %d, expected 1-100", AvifExportParams.Quality)
+			}
+
+			if AvifExportParams.Effort < 0 || AvifExportParams.Effort > 9 {
+				return fmt.Errorf("invalid effort %d, expected 0-9", AvifExportParams.Effort)
+			}
+
+			for _, quality := range []int{SmallQuality, LargeQuality} {
+				if quality < 0 || quality > 100 {
+					return fmt.Errorf("invalid quality %d", quality)
+				}
+			}
+
+			if SVGDensity < 1 || SVGWidth < 0 {
+				return fmt.Errorf("invalid SVG density %d or width %d", SVGDensity, SVGWidth)
+			}
+
+			if HEICPolicy != HEICSkip && HEICPolicy != HEICRepackage && HEICPolicy != HEICConvert {
+				return fmt.Errorf("unknown HEIC policy %q", HEICPolicy)
+			}
+
+			if ImportProfile != "" && ImportProfile != ImportTakeout && ImportProfile != ImportApple {
+				return fmt.Errorf("unknown import profile %q", ImportProfile)
+			}
+
+			if ImportEdited != EditedBoth && ImportEdited != EditedOriginal && ImportEdited != EditedOnly {
+				return fmt.Errorf("unknown edited variant policy %q", ImportEdited)
+			}
+
+			if TargetSSIM < 0 || TargetSSIM > 1 {
+				return fmt.Errorf("invalid target SSIM %v", TargetSSIM)
+			}
+
+			if AvifExportParams.Lossless && TargetSSIM > 0 {
+				return fmt.Errorf("--target-ssim has no effect with --lossless")
+			}
+
+			if Premultiply && AlphaBleed {
+				return ErrAlphaMode
+			}
+
+			if EmbedICC != "" {
+				if err := CheckICCProfile(EmbedICC); err != nil {
+					return err
+				}
+			}
+
+			if StateMaxAge < 0 {
+				return fmt.Errorf("invalid state max age %v", StateMaxAge)
+			}
+
+			if TimeBudget < 0 {
+				return fmt.Errorf("invalid time budget %v", TimeBudget)
+			}
+
+			if ProgressInterval <= 0 {
+				return fmt.Errorf("invalid progress interval %v", ProgressInterval)
+			}
+
+			if MinBattery < 0 || MinBattery > 100 {
+				return fmt.Errorf("invalid battery threshold %d%%", MinBattery)
+			}
+
+			parsed, err := ParseRewrites(RewriteRules)
+
+			if err != nil {
+				return err
+			}
+
+			rewrites = parsed
+
+			if err := CheckExcludes(ExcludePatterns); err != nil {
+				return err
+			}
+
+			if err := CheckFilters(); err != nil {
+				return err
+			}
+
+			if err := CheckThrottle(); err != nil {
+				return err
+			}
+
+			if err := CheckSchedule(); err != nil {
+				return err
+			}
+
+			if OutputDir != "" {
+				KeepOriginals = true
+			}
+
+			if PauseOnBattery || MinBattery > 0 {
+				if _, err := ReadPowerStatus(); err != nil {
+					return err
+				}
+			}
+
+			if Concurrency < 1 {
+				return fmt.Errorf("invalid number of jobs %d", Concurrency)
+			}
+
+			if err := LimitConcurrency(); err != nil {
+				return err
+			}
+
+			if err := ConfigureAffinity(); err != nil {
+				return err
+			}
+
+			// Every command deleting or overwriting files is audited, or
+			// refuses to run when syslog can't be opened.
+			if UseSyslog {
+				auditLog, err := OpenAuditLog()
+
+				if err != nil {
+					return err
+				}
+
+				AuditLog = auditLog
+			}
+
+			if err := PruneState(); err != nil {
+				fmt.Fprintf(os.Stderr, "Can't prune the state directory: %v\n", err)
+			}
+
+			threads := Concurrency
+
+			if Deterministic {
+				threads = 1
+			}
+
+			vips.Startup(&vips.Config{
+				ConcurrencyLevel: threads,
+				MaxCacheMem:      0,
+				MaxCacheSize:     0,
+				MaxCacheFiles:    0,
+				CacheTrace:       false,
+			})
+
+			return nil
+		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			if AuditLog != nil {
+				return AuditLog.Close()
+			}
+
+			return nil
+		},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			StartPrint0()
+
+			separator := byte('\n')
+
+			if FilesFrom0 != "" {
+				if FilesFrom != "" {
+					return fmt.Errorf("--files-from and --files-from0 can't be used together")
+				}
+
+				FilesFrom, separator = FilesFrom0, 0
+			}
+
+			if len(args) == 0 && FilesFrom == "" {
+				return fmt.Errorf("requires at least 1 DIR, or --files-from")
+			}
+
+			if len(args) == 0 {
+				args = []string{"."}
+			}
+
+			if FilesFrom != "" && FromReport != "" {
+				return fmt.Errorf("--files-from and --from-report can't be used together")
+			}
+
+			args, err := ExpandGlobs(args)
+
+			if err != nil {
+				return err
+			}
+
+			args = DedupeRoots(args)
+
+			if ReadOnlySource {
+				if FailureLogPath == "" {
+					path, err := StatePath(strings.TrimPrefix(FailureLogName, "."))
+
+					if err != nil {
+						return err
+					}
+
+					FailureLogPath = path
+				}
+
+				if err := CheckReadOnlySource(args, FailureLogPath, ReportPath, ProgressFile); err != nil {
+					return err
+				}
+
+				KeepOriginals = true
+			}
+
+			if CASDir != "" && !DryRun {
+				sink, err := NewCASSink(CASDir)
+
+				if err != nil {
+					return err
+				}
+
+				ImageSink = sink
+				KeepOriginals = true
+
+				defer func() {
+					if err := sink.SaveManifest(); err != nil {
+						fmt.Printf("Failed to save CAS manifest: %v\n", err)
+					}
+				}()
+			}
+
+			if FailureLogPath == "" && OutputDir != "" {
+				FailureLogPath = filepath.Join(OutputDir, FailureLogName)
+			}
+
+			if FailureLogPath == "" {
+				FailureLogPath = filepath.Join(args[0], FailureLogName)
+			}
+
+			// A dry run writes nothing, so it doesn't touch the log either.
+			if !Resume && !DryRun {
+				if err := ResetFailureLog(); err != nil {
+					return err
+				}
+			}
+
+			defer CloseFailureLog()
+			defer CloseJournals()
+
+			TraceRoot = StartSpan(nil, "avify", "roots", strings.Join(args, ","))
+
+			defer func() {
+				TraceRoot.End(nil)
+
+				ShutdownTracing()
+			}()
+
+			started := time.Now()
+			cpu := CPUTime()
+
+			discovery := &Discovery{Skipped: map[SkipReason]int{}}
+
+			discover := FindImagesAt
+
+			if FromReport != "" {
+				report, err := ReadReport(FromReport)
+
+				if err != nil {
+					return err
+				}
+
+				discover = func(root string) (*Discovery, error) {
+					return FindReportedImagesAt(root, report, ReportSubsets)
+				}
+
+				discovery.SkipOutside(report.Paths(), args)
+			}
+
+			if FilesFrom != "" {
+				paths, err := ReadFileList(FilesFrom, separator)
+
+				if err != nil {
+					return err
+				}
+
+				discover = func(root string) (*Discovery, error) {
+					return FindListedImagesAt(root, paths)
+				}
+
+				discovery.SkipOutside(paths, args)
+			}
+
+			checkpointPath, err := CheckpointPath(args)
+
+			if err != nil {
+				return err
+			}
+
+			var checkpoint *Checkpoint
+
+			if Resume {
+				if checkpoint, err = LoadCheckpoint(checkpointPath); err != nil {
+					return err
+				}
+
+				if checkpoint == nil {
+					fmt.Println("No checkpoint to resume, starting over")
+				} else {
+					fmt.Printf("Resuming, %d images already done\n", len(checkpoint.Prior))
+
+					discover = checkpoint.PendingAt
+				}
+			}
+
+			for _, root := range args {
+				span := StartSpan(TraceRoot, "discovery", "root", root)
+
+				found, err := discover(root)
+
+				span.End(err)
+
+				if err != nil {
+					return err
+				}
+
+				discovery.Merge(found)
+			}
+
+			defer discovery.PrintSkipped()
+
+			FilterVariants(discovery)
+
+			jobs := discovery.Jobs
+
+			knownBad, knownBadPath, err := LoadKnownBad()
+
+			if err != nil {
+				return err
+			}
+
+			if SkipKnownBad {
+				var skipped []string
+
+				jobs, skipped = knownBad.Filter(jobs)
+
+				discovery.Jobs = jobs
+
+				for _, path := range skipped {
+					discovery.Skip(SkipKnownFailure, path)
+				}
+			}
+
+			manifests, err := LoadManifests(args)
+
+			if err != nil {
+				return err
+			}
+
+			jobs, skipped := manifests.Filter(jobs)
+
+			discovery.Jobs = jobs
+
+			for _, path := range skipped {
+				discovery.Skip(SkipManifest, path)
+			}
+
+			discovered := time.Since(started)
+
+			if discovery.Histogram != nil {
+				discovery.Histogram.Print()
+			}
+
+			if len(jobs) == 0 {
+				if checkpoint != nil {
+					checkpoint.Remove()
+				}
+
+				fmt.Println("No images found")
+
+				return nil
+			}
+
+			if renamed := PlanOutputs(jobs); len(renamed) > 0 {
+				fmt.Println("Following outputs are renamed to avoid collisions:")
+
+				for _, job := range renamed {
+					fmt.Printf("\t%s -> %s\n", job.Path, job.Output)
+				}
+			}
+
+			if DryRun {
+				PrintDryRun(jobs)
+
+				return nil
+			}
+
+			if checkpoint == nil {
+				if checkpoint, err = NewCheckpoint(checkpointPath, args, jobs); err != nil {
+					return err
+				}
+			}
+
+			if err := checkpoint.Open(); err != nil {
+				return err
+			}
+
+			trees := map[string]*TreeChecksums{}
+
+			if TreeChecksum {
+				if err := TreeDigests(args, trees, false); err != nil {
+					return err
+				}
+			}
+
+			RunCheckpoint = checkpoint
+
+			ctx, cancel := InterruptContext(context.Background())
+
+			defer cancel()
+
+			stats := ConvertImages(ctx, jobs)
+			interrupted := Interrupted(ctx, stats, jobs)
+
+			// The prior results were recorded by the run that made them.
+			results, failed := stats.Results, len(stats.Failed)
+
+			stats.Restore(checkpoint, args)
+
+			manifests.Record(jobs, stats.Results)
+			manifests.Save()
+
+			if interrupted {
+				fmt.Println("Interrupted, run again with --resume to convert the remaining files")
+			} else if err := checkpoint.Remove(); err != nil {
+				fmt.Printf("Failed to remove checkpoint: %v\n", err)
+			}
+
+			if failed > 0 {
+				knownBad.Record(results)
+
+				if err := knownBad.Save(knownBadPath); err != nil {
+					fmt.Printf("Failed to save known-bad list: %v\n", err)
+				}
+			}
+
+			if TreeChecksum {
+				if err := TreeDigests(args, trees, true); err != nil {
+					return err
+				}
+
+				stats.Trees = trees
+			}
+
+			stats.Timings.Discovery = discovered
+			stats.Timings.CPU = CPUTime() - cpu
+			stats.Timings.Total = time.Since(started)
+
+			stats.PrintSummary()
+			stats.Timings.Print()
+
+			for _, root := range slices.Sorted(maps.Keys(stats.Trees)) {
+				fmt.Printf("Tree checksum of %s: %s -> %s\n", root, stats.Trees[root].Before, stats.Trees[root].After)
+			}
+
+			if ReportPath != "" {
+				if err := WriteReport(ReportPath, discovery, stats); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+
+	rootCmd.Flags().DurationVar(&TimeBudget, "time-budget", 0, "lower the effort of the remaining files when the run falls behind this `DURATION`, and raise it when well ahead")
+	rootCmd.Flags().BoolVar(&Resume, "resume", false, "continue an interrupted run over the same roots from its checkpoint, without walking the roots again")
+	rootCmd.Flags().BoolVar(&NoManifest, "no-manifest", false, "neither skip files recorded in nor record converted files to "+ManifestName+" under the root")
+	rootCmd.Flags().BoolVar(&TreeChecksum, "tree-checksum", false, "record a Merkle digest of every root, over names and contents, before and after the run in the report")
+	rootCmd.Flags().BoolVarP(&DryRun, "dry-run", "n", false, "only list the files that would be converted or skipped, with their total size, without touching anything")
+	rootCmd.Flags().StringVar(&CASDir, "cas", "", "store outputs content-addressed in `DIR` with a manifest, keeping originals")
+	rootCmd.Flags().BoolVar(&ReadOnlySource, "read-only-source", false, "never write to the source tree, keeping outputs and state in the destination and the state directory")
+	rootCmd.Flags().StringVar(&ImportProfile, "import", "", "treat the root as an export of `PROFILE` (takeout or apple), merging sidecar metadata into the AVIF")
+	rootCmd.Flags().StringVar(&ImportEdited, "import-edited", ImportEdited, "which variant of original/edited pairs to convert with --import: both, original or edited")
+	rootCmd.Flags().BoolVar(&DiscoveryStats, "discovery-stats", false, "read image headers during discovery and show format, size and orientation histograms before converting")
+	rootCmd.Flags().StringVar(&FilesFrom, "files-from", "", "convert only the files listed one per line in `FILE` (- for stdin) under DIR, the current directory by default, instead of walking it")
+	rootCmd.Flags().StringVar(&FilesFrom0, "files-from0", "", "like --files-from, with NUL-terminated paths as printed by find -print0")
+	rootCmd.Flags().BoolVar(&Print0, "print0", false, "print the status and path of every processed file, NUL-terminated, to stdout, and everything else to stderr")
+	rootCmd.Flags().StringVar(&FromReport, "from-report", "", "convert only files listed in the JSON report `FILE` of a previous run, instead of walking DIR")
+	rootCmd.Flags().StringSliceVar(&ReportSubsets, "subset", ReportSubsets, "which files of --from-report to convert: failed, larger, no-gain, banding or protected")
+	rootCmd.Flags().StringVar(&ReportPath, "report", "", "write a JSON report of the run to `FILE`")
+	rootCmd.Flags().BoolVar(&SkipKnownBad, "skip-known-bad", false, "skip files whose content already failed the same way in previous runs")
+	rootCmd.Flags().IntVar(&KnownBadAttempts, "known-bad-after", KnownBadAttempts, "number of identical failures after which a file is known to be bad")
+	rootCmd.Flags().StringVar(&OtelEndpoint, "otel-endpoint", "", "export OpenTelemetry traces of the run to the OTLP/HTTP collector at `URL` (e.g. http://localhost:4318)")
+
+	// Options of the conversion itself are persistent, so that watch, the
+	// daemon and queue run convert the same way as a run over DIR.
+	rootCmd.PersistentFlags().BoolVar(&RasterizeSVG, "svg", false, "rasterize SVG files to AVIF fallbacks next to them, instead of skipping them")
+	rootCmd.PersistentFlags().IntVar(&SVGDensity, "svg-density", SVGDensity, "`DPI` SVG files are rasterized at with --svg")
+	rootCmd.PersistentFlags().IntVar(&SVGWidth, "svg-width", 0, "rasterize SVG files to this width in `PIXELS` with --svg, whatever their size")
+	rootCmd.PersistentFlags().DurationVar(&Timeout, "timeout", 0, "record a file as failed when its conversion takes longer than this `DURATION`, e.g. 120s, and move on")
+	rootCmd.PersistentFlags().BoolVar(&KeepICO, "keep-ico", false, "keep ICO originals as a fallback for old browsers, next to the AVIF of their largest bitmap")
+	rootCmd.PersistentFlags().Var(&MinSavings, "min-savings", "keep the original and discard the AVIF unless it saves at least this share, e.g. 5%")
+	rootCmd.PersistentFlags().BoolVarP(&KeepOriginals, "keep", "k", false, "write outputs next to the originals and leave the originals untouched")
+	rootCmd.PersistentFlags().StringVarP(&OutputDir, "output", "o", "", "write outputs into `DIR`, mirroring the paths under the root and keeping originals")
+	rootCmd.PersistentFlags().StringArrayVar(&RewriteRules, "rewrite", nil, "write outputs of sources under `SRC=DST` prefix SRC under DST instead (repeatable, the longest match wins)")
+	rootCmd.PersistentFlags().StringArrayVar(&ExcludePatterns, "exclude", nil, "skip files and whole directories matching `GLOB`, relative to the root; ** matches any number of directories (repeatable)")
+	rootCmd.PersistentFlags().StringSliceVar(&Extensions, "ext", nil, "only convert files with these `EXTENSIONS`, e.g. jpg,png (jpg also selects jpeg)")
+	rootCmd.PersistentFlags().StringVar(&IncludePattern, "include", "", "only convert files whose path matches `REGEX`")
+	rootCmd.PersistentFlags().BoolVar(&RespectGitignore, "respect-gitignore", false, "skip files and directories ignored by .gitignore files in the tree, and .git directories")
+	rootCmd.PersistentFlags().StringVar(&HEICPolicy, "heic", HEICPolicy, "what to do with HEIC/HEIF files: skip, repackage (AV1 coded files only, without re-encoding) or convert (decode and re-encode)")
+	rootCmd.PersistentFlags().StringVar(&OrganizeByDate, "organize-by-date", "", "write outputs into a capture date `LAYOUT` under the root (Go time layout, e.g. 2006/01)")
+	rootCmd.PersistentFlags().BoolVar(&ExifSidecar, "exif-sidecar", false, "store the complete original EXIF of files with MakerNotes next to the output as NAME.avif"+ExifSidecarExt)
+	rootCmd.PersistentFlags().StringArrayVar(&ProtectPatterns, "protect", nil, "never delete originals whose file name matches `GLOB` (e.g. '*-edited.*')")
+	rootCmd.PersistentFlags().StringArrayVar(&ProtectXMP, "protect-xmp", nil, "never delete originals whose XMP packet contains `TEXT`")
+	rootCmd.PersistentFlags().StringVar(&CollisionPolicy, "on-collision", CollisionPolicy, "how to resolve sources mapping to the same output: suffix or fail")
+	rootCmd.PersistentFlags().BoolVar(&Premultiply, "premultiply", false, "round-trip color through premultiplied alpha, so fully transparent pixels carry no stray color")
+	rootCmd.PersistentFlags().BoolVar(&AlphaBleed, "alpha-bleed", false, "fill fully transparent pixels with the color of their visible neighbours, avoiding halos around icons")
+	rootCmd.PersistentFlags().Float64Var(&AlphaBleedSigma, "alpha-bleed-sigma", AlphaBleedSigma, "blur sigma in pixels controlling how far colors bleed into transparent areas with --alpha-bleed")
+	rootCmd.PersistentFlags().StringVar(&EmbedICC, "embed-icc", "", "convert every image to the ICC profile at `PATH` and embed it, replacing the profile of the source")
+	rootCmd.PersistentFlags().BoolVar(&CheckBanding, "check-banding", false, "analyze outputs for banding in smooth gradients")
+	rootCmd.PersistentFlags().Float64Var(&BandingThreshold, "banding-threshold", BandingThreshold, "share of gradient change turned into visible steps to flag a file")
+	rootCmd.PersistentFlags().Float64Var(&TargetSSIM, "target-ssim", 0, "search the lowest quality per image whose output reaches this SSIM against the source (e.g. 0.97)")
+	rootCmd.PersistentFlags().IntVarP(&AvifExportParams.Quality, "quality", "q", AvifExportParams.Quality, "AVIF quality from 1 (smallest) to 100 (best)")
+	rootCmd.PersistentFlags().IntVar(&AvifExportParams.Effort, "effort", AvifExportParams.Effort, "encoder effort from 0 (fastest) to 9 (smallest output)")
+	rootCmd.PersistentFlags().BoolVar(&AvifExportParams.Lossless, "lossless", false, "encode losslessly, keeping pixels bit-exact (e.g. for screenshots and pixel art); quality is ignored")
+	rootCmd.PersistentFlags().IntVar(&SmallQuality, "small-quality", 0, "quality for images below the small threshold (0 keeps the default)")
+	rootCmd.PersistentFlags().IntVar(&LargeQuality, "large-quality", 0, "quality for images at or above the large threshold (0 keeps the default)")
+	rootCmd.PersistentFlags().Var(&SmallThreshold, "small-threshold", "pixel count below which an image is small, e.g. 1MP or 250000")
+	rootCmd.PersistentFlags().Var(&LargeThreshold, "large-threshold", "pixel count from which an image is large, e.g. 8MP")
+	rootCmd.PersistentFlags().Float64Var(&MaxLoad, "max-load", 0, "run one worker fewer every 10s while the 1-minute load average is above `LOAD`")
+	rootCmd.PersistentFlags().Float64Var(&MaxTemperature, "max-temp", 0, "run one worker fewer every 10s while the CPU is hotter than `CELSIUS`, Linux only")
+	rootCmd.PersistentFlags().BoolVar(&PauseOnBattery, "pause-on-battery", false, "stop starting new conversions while running on battery, resuming on AC power")
+	rootCmd.PersistentFlags().IntVar(&MinBattery, "min-battery", 0, "stop starting new conversions while on battery below `PERCENT` charge")
+	rootCmd.PersistentFlags().BoolVar(&UseXattrs, "xattr", false, "tag outputs with "+XattrVersion+" and "+XattrSettings+", and originals kept for no gain with "+XattrSkipped+" so later runs skip them")
+	rootCmd.PersistentFlags().Int64Var(&BatchThreshold, "batch-threshold", BatchThreshold, "convert files smaller than `BYTES` in batches per worker task (0 disables batching)")
+	rootCmd.PersistentFlags().IntVar(&MaxBatchSize, "batch-size", MaxBatchSize, "maximum number of small files per worker task")
+	rootCmd.PersistentFlags().IntVar(&RecycleEvery, "recycle-every", 0, "drop the libvips cache and return freed memory to the OS every `N` conversions")
+	rootCmd.PersistentFlags().BoolVar(&ManifestHashes, "manifest-hashes", false, "record SHA-256 of every source and output in the report, computed while reading and writing")
+	rootCmd.PersistentFlags().StringVar(&ProgressFile, "progress-file", "", "keep a JSON summary of the run progress in `FILE`, rewritten atomically every few seconds")
+	rootCmd.PersistentFlags().DurationVar(&ProgressInterval, "progress-interval", ProgressInterval, "how often to rewrite the progress file")
+	rootCmd.PersistentFlags().StringVar(&FailureLogPath, "failures-log", "", "write the failures of the run to `FILE` as they happen (default DIR/"+FailureLogName+")")
+	rootCmd.PersistentFlags().BoolVar(&UseSyslog, "syslog", false, "record deleted and overwritten files to syslog, keeping those that can't be recorded")
+
+	rootCmd.PersistentFlags().IntVarP(&Concurrency, "jobs", "j", Concurrency, "number of images converted in parallel, also used as the libvips thread count")
+	rootCmd.PersistentFlags().BoolVar(&Deterministic, "deterministic", false, "encode every image on a single libvips thread, so the same input always gives a byte-identical AVIF")
+	rootCmd.PersistentFlags().StringVar(&ConfigPath, "config", "", "read default options from `FILE` (default ~/.config/avify/"+ConfigName+")")
+	rootCmd.PersistentFlags().StringVar(&Profile, "profile", "", "apply the preset `NAME` (web or archive) to flags not given explicitly")
+	rootCmd.PersistentFlags().BoolVar(&ForceUnsafePath, "force-unsafe-path", false, "allow roots like / or the home directory, and trees containing system or application directories")
+	rootCmd.PersistentFlags().StringVar(&CPUAffinity, "cpu-affinity", "", "pin workers to the CPUs in `LIST` (e.g. 0-15,32-47), Linux only")
+	rootCmd.PersistentFlags().IntVar(&NUMANode, "numa-node", -1, "pin workers to the CPUs of NUMA `NODE`, keeping their memory local, Linux only")
+	rootCmd.PersistentFlags().Var(&DaytimeSettings, "daytime", "in watch, the daemon and queue run, use these `SETTINGS` (e.g. effort=3,jobs=2) during the day")
+	rootCmd.PersistentFlags().Var(&NightSettings, "night", "in watch, the daemon and queue run, use these `SETTINGS` (e.g. effort=7,jobs=16) outside of the day")
+	rootCmd.PersistentFlags().StringVar(&DayHours, "day-hours", DayHours, "the hours of the day for --daytime, e.g. 8-20, the rest is night")
+	rootCmd.PersistentFlags().DurationVar(&StateMaxAge, "state-max-age", StateMaxAge, "forget checkpoints, manifests and known-bad files not used for this long, 0 keeps them forever")
+	rootCmd.PersistentFlags().StringVar(&AvifBrand, "brand", "", "override the major brand of the AVIF container (e.g. avif, avis)")
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use: "version",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("avify %s (%s, vips %v)\n", Version, runtime.Version(), vips.Version)
+		},
+	})
+
+	rootCmd.AddCommand(NewSequenceCmd())
+	rootCmd.AddCommand(NewInspectCmd())
+	rootCmd.AddCommand(NewServeCompareCmd())
+	rootCmd.AddCommand(NewSyncCmd())
+	rootCmd.AddCommand(NewQueueCmd())
+	rootCmd.AddCommand(NewCleanCmd())
+	rootCmd.AddCommand(NewReportCmd())
+	rootCmd.AddCommand(NewCorpusCmd())
+	rootCmd.AddCommand(NewUsageCmd())
+	rootCmd.AddCommand(NewInitCmd())
+	rootCmd.AddCommand(NewWatchCmd())
+	rootCmd.AddCommand(NewDaemonCmd())
+	rootCmd.AddCommand(NewCtlCmd())
+	rootCmd.AddCommand(NewConfigCmd(rootCmd.Flags()))
+
+	return rootCmd
+}
+
+func main() {
+	vips.LoggingSettings(nil, vips.LogLevelError)
+
+	defer vips.Shutdown()
+
+	if err := NewRootCmd().Execute(); err != nil {
+		vips.Shutdown()
 
-	if err := rootCmd.Execute(); err != nil {
-		panic(err)
+		os.Exit(1)
 	}
 }
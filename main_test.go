@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestFormatSaving(t *testing.T) {
+	for _, test := range []struct {
+		before, after uint64
+		want          string
+	}{
+		{2048, 1024, "1.0KB"},
+		{1024, 1024, "0 B"},
+		{1024, 3072, "-2.0KB"},
+	} {
+		if got := FormatSaving(test.before, test.after); got != test.want {
+			t.Errorf("FormatSaving(%d, %d) = %q, want %q", test.before, test.after, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const ManifestName = ".avify-manifest.json"
+
+var NoManifest = false
+
+type ManifestEntry struct {
+	Path     string    `json:"path"`
+	Output   string    `json:"output"`
+	Settings string    `json:"settings"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// Manifest maps the SHA-256 of sources converted with their originals kept
+// to their outputs, so later runs skip them, even after a rename.
+type Manifest struct {
+	Files map[string]*ManifestEntry `json:"files"`
+
+	path   string
+	paths  map[string]string
+	sizes  map[int64]bool
+	change bool
+}
+
+// ManifestPath is the manifest under root, or in the state directory when
+// nothing may be written to the source tree. With --output the source tree is
+// left alone too, and every root mirrored into the output directory has its
+// own manifest for that directory.
+func ManifestPath(root string) (string, error) {
+	if !ReadOnlySource && OutputDir == "" {
+		return filepath.Join(root, ManifestName), nil
+	}
+
+	abs, err := filepath.Abs(root)
+
+	if err != nil {
+		return "", err
+	}
+
+	key := abs
+
+	if OutputDir != "" {
+		output, err := filepath.Abs(OutputDir)
+
+		if err != nil {
+			return "", err
+		}
+
+		key += "\x00" + output
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	return StatePath(fmt.Sprintf("manifest-%x.json", sum[:8]))
+}
+
+func LoadManifest(root string) (*Manifest, error) {
+	path, err := ManifestPath(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{Files: map[string]*ManifestEntry{}, path: path}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(data, manifest); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	manifest.paths = map[string]string{}
+	manifest.sizes = map[int64]bool{}
+
+	for hash, entry := range manifest.Files {
+		manifest.paths[entry.Path] = hash
+		manifest.sizes[entry.Size] = true
+	}
+
+	return manifest, nil
+}
+
+func (m *Manifest) Save() error {
+	if !m.change {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	tmp := m.path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.path)
+}
+
+// Converted tells whether job was converted with the same settings and its
+// output is still there. Unchanged size and modification time are trusted,
+// other files are hashed only when an entry of the same size exists.
+func (m *Manifest) Converted(job *Job) bool {
+	info, err := os.Stat(job.Path)
+
+	if err != nil {
+		return false
+	}
+
+	var entry *ManifestEntry
+
+	if hash, ok := m.paths[job.Path]; ok {
+		entry = m.Files[hash]
+
+		if entry.Size != info.Size() || !entry.Modified.Equal(info.ModTime()) {
+			entry = nil
+		}
+	}
+
+	if entry == nil && m.sizes[info.Size()] {
+		if hash, err := HashFile(job.Path); err == nil {
+			entry = m.Files[hash]
+		}
+	}
+
+	if entry == nil || entry.Settings != SettingsHash(job.ExportParams()) {
+		return false
+	}
+
+	output := entry.Output
+
+	// With --cas the output is a logical path, stored as a blob.
+	if sink, ok := ImageSink.(*CASSink); ok {
+		if output, ok = sink.Object(entry.Output); !ok {
+			return false
+		}
+	}
+
+	_, err = os.Stat(output)
+
+	return err == nil
+}
+
+// Record adds converted results whose originals were kept. Replaced ones
+// can't come back, so there is no point in keeping them.
+func (m *Manifest) Record(job *Job, result *Result) error {
+	if result.Status != StatusConverted || result.Replaced {
+		return nil
+	}
+
+	info, err := os.Stat(job.Path)
+
+	if err != nil {
+		return err
+	}
+
+	hash := result.SourceHash
+
+	if hash == "" {
+		if hash, err = HashFile(job.Path); err != nil {
+			return err
+		}
+	}
+
+	m.Files[hash] = &ManifestEntry{Path: job.Path, Output: result.Output, Settings: SettingsHash(job.ExportParams()), Size: info.Size(), Modified: info.ModTime()}
+	m.paths[job.Path] = hash
+	m.sizes[info.Size()] = true
+	m.change = true
+
+	return nil
+}
+
+type Manifests map[string]*Manifest
+
+func LoadManifests(roots []string) (Manifests, error) {
+	manifests := Manifests{}
+
+	if NoManifest {
+		return manifests, nil
+	}
+
+	for _, root := range roots {
+		manifest, err := LoadManifest(root)
+
+		if err != nil {
+			return nil, err
+		}
+
+		manifests[root] = manifest
+	}
+
+	return manifests, nil
+}
+
+func (m Manifests) Filter(jobs []*Job) ([]*Job, []string) {
+	if len(m) == 0 {
+		return jobs, nil
+	}
+
+	var kept []*Job
+	var skipped []string
+
+	for _, job := range jobs {
+		if manifest := m[job.Root]; manifest != nil && manifest.Converted(job) {
+			skipped = append(skipped, job.Path)
+
+			continue
+		}
+
+		kept = append(kept, job)
+	}
+
+	return kept, skipped
+}
+
+func (m Manifests) Record(jobs []*Job, results []*Result) {
+	byPath := map[string]*Job{}
+
+	for _, job := range jobs {
+		byPath[job.Path] = job
+	}
+
+	for _, result := range results {
+		job := byPath[result.Path]
+
+		if job == nil || m[job.Root] == nil {
+			continue
+		}
+
+		if err := m[job.Root].Record(job, result); err != nil {
+			fmt.Printf("Failed to record %s in the manifest: %v\n", result.Path, err)
+		}
+	}
+}
+
+func (m Manifests) Save() {
+	for _, manifest := range m {
+		if err := manifest.Save(); err != nil {
+			fmt.Printf("Failed to save manifest: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/demiazz/avify/convert"
+)
+
+// RunObserver is notified about the files of a run, see convert.Observer.
+// Jobs, results and stats are handed over as the library types.
+var RunObserver convert.Observer = &ProgressObserver{}
+
+func (j *Job) File() convert.File {
+	return convert.File{Path: j.Path, Output: j.Output}
+}
+
+func (r *Result) Observed() convert.Result {
+	return convert.Result{Format: r.Format, SizeBefore: int64(r.SizeBefore), SizeAfter: int64(r.SizeAfter)}
+}
+
+func (s *Stats) Summary() convert.Summary {
+	return convert.Summary{
+		Converted:  len(s.Results) - len(s.Failed) - len(s.NoGain),
+		Skipped:    len(s.NoGain),
+		Failed:     len(s.Failed),
+		SizeBefore: int64(s.SizeBefore),
+		SizeAfter:  int64(s.SizeAfter),
+	}
+}
+
+// ProgressObserver renders the progress bar.
+type ProgressObserver struct {
+	phase      convert.Phase
+	discovered int
+}
+
+func (o *ProgressObserver) OnPhase(phase convert.Phase, total int) {
+	switch phase {
+	case convert.PhaseDiscovery:
+		Progress.ChangeMax(-1)
+		Progress.Describe(Highlight("Search images..."))
+	case convert.PhaseConversion:
+		Progress.Reset()
+		Progress.ChangeMax(total)
+		Progress.Describe(Highlight("Converting images..."))
+	case convert.PhaseDone:
+		Progress.Exit()
+
+		if o.phase == convert.PhaseConversion {
+			fmt.Println()
+		}
+	}
+
+	o.phase = phase
+	o.discovered = 0
+}
+
+func (o *ProgressObserver) OnDiscovered(file convert.File) {
+	o.discovered += 1
+
+	if o.discovered >= 20 {
+		Progress.Add(o.discovered)
+
+		o.discovered = 0
+	}
+}
+
+func (o *ProgressObserver) OnStart(file convert.File) {}
+
+func (o *ProgressObserver) OnComplete(file convert.File, result convert.Result) {
+	Progress.Add(1)
+}
+
+func (o *ProgressObserver) OnSkip(file convert.File, result convert.Result) {
+	Progress.Add(1)
+}
+
+func (o *ProgressObserver) OnError(file convert.File, err error) {
+	Progress.Add(1)
+}
+
+func (o *ProgressObserver) OnPause(reason string) {
+	if reason == "" {
+		Progress.Describe(Highlight("Converting images..."))
+
+		return
+	}
+
+	Progress.Describe(Highlight("Paused, " + reason + "..."))
+}
+
+func (o *ProgressObserver) OnSummary(summary convert.Summary) {}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	CollisionSuffix = "suffix"
+	CollisionFail   = "fail"
+)
+
+var OutputDir = ""
+
+var reservedMu sync.Mutex
+
+var reserved = map[string]bool{}
+
+func OutputPath(job *Job, image Image) string {
+	if job.Output != "" {
+		return job.Output
+	}
+
+	if OrganizeByDate == "" {
+		return ReplaceExt(RewritePath(MirrorPath(job)))
+	}
+
+	base := job.Root
+
+	if OutputDir != "" {
+		base = OutputDir
+	}
+
+	date := CaptureTime(image, job.Path)
+	target := RewritePath(filepath.Join(base, date.Format(OrganizeByDate), ReplaceExt(filepath.Base(job.Path))))
+
+	return Reserve(target)
+}
+
+// MirrorPath is the path of the source in the output tree, at the same
+// place relative to OutputDir as the source is relative to its root.
+func MirrorPath(job *Job) string {
+	if OutputDir == "" {
+		return job.Path
+	}
+
+	rel, err := filepath.Rel(job.Root, job.Path)
+
+	if err != nil {
+		return filepath.Join(OutputDir, filepath.Base(job.Path))
+	}
+
+	return filepath.Join(OutputDir, rel)
+}
+
+func Reserve(path string) string {
+	reservedMu.Lock()
+	defer reservedMu.Unlock()
+
+	candidate := UniquePath(path, func(candidate string) bool {
+		return reserved[OutputKey(candidate)]
+	})
+
+	reserved[OutputKey(candidate)] = true
+
+	return candidate
+}
+
+// UniquePath suffixes path until it isn't taken by another output of this
+// run. Files left by previous runs don't count, so running again writes the
+// same outputs instead of duplicates.
+func UniquePath(path string, taken func(string) bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	candidate := path
+
+	for i := 1; taken(candidate); i++ {
+		candidate = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+
+	return candidate
+}
+
+var (
+	foldMu sync.Mutex
+	folded = map[string]bool{}
+)
+
+// OutputKey is path as the filesystem tells it apart from other paths: in
+// lower case where names differing in case only are the same file.
+func OutputKey(path string) string {
+	dir := filepath.Dir(path)
+
+	foldMu.Lock()
+	fold, ok := folded[dir]
+
+	if !ok {
+		fold = FoldsCase(dir)
+		folded[dir] = fold
+	}
+
+	foldMu.Unlock()
+
+	if fold {
+		return strings.ToLower(path)
+	}
+
+	return path
+}
+
+// FoldsCase tells whether the filesystem of dir matches names regardless of
+// their case. The nearest existing ancestor with letters in its name is
+// looked up with the case swapped: on such filesystems it is the same
+// directory. Without one, macOS and Windows are assumed to fold case.
+func FoldsCase(dir string) bool {
+	path, err := filepath.Abs(dir)
+
+	if err != nil {
+		path = dir
+	}
+
+	for {
+		name := filepath.Base(path)
+		swapped := swapCase(name)
+
+		if info, err := os.Stat(path); err == nil && swapped != name {
+			other, err := os.Stat(filepath.Join(filepath.Dir(path), swapped))
+
+			return err == nil && os.SameFile(info, other)
+		}
+
+		parent := filepath.Dir(path)
+
+		if parent == path {
+			return runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+		}
+
+		path = parent
+	}
+}
+
+func swapCase(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+
+		return unicode.ToUpper(r)
+	}, name)
+}
+
+// PlanOutputs assigns output paths ahead of conversion, so sources like
+// Photo.JPG and photo.jpg don't silently overwrite each other's AVIF on
+// case-insensitive filesystems, and sources like photo.jpg and photo.png
+// don't anywhere. It returns the jobs whose output was renamed.
+func PlanOutputs(jobs []*Job) []*Job {
+	if OrganizeByDate != "" {
+		return nil
+	}
+
+	planned := map[string]string{}
+
+	var renamed []*Job
+
+	for _, job := range jobs {
+		natural := ReplaceExt(RewritePath(MirrorPath(job)))
+
+		owner, collides := planned[OutputKey(natural)]
+
+		if !collides {
+			planned[OutputKey(natural)] = job.Path
+			job.Output = natural
+
+			continue
+		}
+
+		if CollisionPolicy == CollisionFail {
+			job.Error = fmt.Errorf("output %s collides with the output of %s", natural, owner)
+
+			continue
+		}
+
+		job.Output = UniquePath(natural, func(candidate string) bool {
+			_, ok := planned[OutputKey(candidate)]
+
+			return ok
+		})
+
+		planned[OutputKey(job.Output)] = job.Path
+
+		renamed = append(renamed, job)
+	}
+
+	return renamed
+}
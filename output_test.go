@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanOutputs(t *testing.T) {
+	root := writeTree(t, map[string]string{"photo.avif": "previous run"})
+
+	if FoldsCase(root) {
+		t.Skip("the temporary directory folds case")
+	}
+
+	jobs := []*Job{
+		{Root: root, Path: filepath.Join(root, "Photo.JPG")},
+		{Root: root, Path: filepath.Join(root, "photo.jpg")},
+		{Root: root, Path: filepath.Join(root, "photo.png")},
+	}
+
+	renamed := PlanOutputs(jobs)
+
+	for i, want := range []string{"Photo.avif", "photo.avif", "photo-1.avif"} {
+		if got := filepath.Base(jobs[i].Output); got != want {
+			t.Errorf("output of %s is %s, want %s", filepath.Base(jobs[i].Path), got, want)
+		}
+	}
+
+	if len(renamed) != 1 || renamed[0] != jobs[2] {
+		t.Errorf("renamed %d jobs, want photo.png only", len(renamed))
+	}
+}
+
+func TestReserveIgnoresPreviousRuns(t *testing.T) {
+	root := writeTree(t, map[string]string{"2024/photo.avif": "previous run"})
+	path := filepath.Join(root, "2024", "photo.avif")
+
+	if got := Reserve(path); got != path {
+		t.Errorf("reserved %s over an output of a previous run, want %s", got, path)
+	}
+
+	if got := Reserve(path); got == path {
+		t.Error("reserved the same path twice in a run")
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Error(err)
+	}
+}
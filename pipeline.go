@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+// region Interfaces
+
+type Image interface {
+	Width() int
+	Height() int
+	Close()
+}
+
+type Decoder interface {
+	Decode(r io.Reader) (Image, error)
+}
+
+type Encoder interface {
+	Encode(image Image, params *vips.AvifExportParams) ([]byte, error)
+}
+
+type Sink interface {
+	Write(path string, data []byte) error
+	Remove(path string) error
+}
+
+var (
+	ImageDecoder Decoder = VipsDecoder{}
+	ImageEncoder Encoder = VipsEncoder{}
+	ImageSink    Sink    = FileSink{}
+)
+
+// endregion Interfaces
+
+// region Vips
+
+var ErrUnexpectedImage = errors.New("unexpected image implementation")
+
+type VipsDecoder struct{}
+
+func (VipsDecoder) Decode(r io.Reader) (Image, error) {
+	buffered := bufio.NewReader(r)
+
+	if header, _ := buffered.Peek(4); IsICO(header) {
+		return decodeICO(buffered)
+	}
+
+	if header, _ := buffered.Peek(1024); RasterizeSVG && looksSVG(header) {
+		return decodeSVG(buffered)
+	}
+
+	image, err := vips.NewImageFromReader(buffered)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+func decodeICO(r io.Reader) (Image, error) {
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	largest, err := LargestICOImage(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := vips.NewImageFromBuffer(largest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+}
+
+type VipsEncoder struct{}
+
+func (VipsEncoder) Encode(image Image, params *vips.AvifExportParams) ([]byte, error) {
+	ref, ok := image.(*vips.ImageRef)
+
+	if !ok {
+		return nil, ErrUnexpectedImage
+	}
+
+	return ExportAvif(ref, params)
+}
+
+func ExportAvif(ref *vips.ImageRef, params *vips.AvifExportParams) ([]byte, error) {
+	bytes, _, err := ref.ExportAvif(params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if AvifBrand != "" {
+		if err := SetMajorBrand(bytes, AvifBrand); err != nil {
+			return nil, err
+		}
+	}
+
+	return bytes, nil
+}
+
+// endregion Vips
+
+// region File
+
+const TempExt = ".tmp"
+
+type FileSink struct{}
+
+func (FileSink) Write(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	_, statErr := os.Stat(path)
+
+	tmp := path + TempExt
+
+	if err := writePreallocated(tmp, data); err != nil {
+		os.Remove(tmp)
+
+		return err
+	}
+
+	if statErr == nil {
+		if err := Audit(AuditOverwrite, path); err != nil {
+			os.Remove(tmp)
+
+			return err
+		}
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+
+		return err
+	}
+
+	return nil
+}
+
+// writePreallocated reserves the whole file before writing, which keeps it
+// contiguous and fails early when the disk is full.
+func writePreallocated(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	err = Preallocate(file, int64(len(data)))
+
+	if err == nil {
+		_, err = file.Write(data)
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (FileSink) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// endregion File
@@ -0,0 +1,71 @@
+//go:build fake
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+// Builds with the `fake` tag replace libvips with a deterministic stand-in, so
+// traversal and bookkeeping can be exercised without decoding real images.
+
+var ErrFakeFailure = errors.New("fake: forced failure")
+
+var fakeFailureMarker = []byte("FAIL")
+
+type FakeImage struct {
+	data []byte
+}
+
+func (i *FakeImage) Width() int {
+	return len(i.data)
+}
+
+func (i *FakeImage) Height() int {
+	return 1
+}
+
+func (i *FakeImage) Close() {
+	i.data = nil
+}
+
+type FakeDecoder struct{}
+
+func (FakeDecoder) Decode(r io.Reader) (Image, error) {
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, fakeFailureMarker) {
+		return nil, ErrFakeFailure
+	}
+
+	return &FakeImage{data: data}, nil
+}
+
+type FakeEncoder struct{}
+
+func (FakeEncoder) Encode(image Image, params *vips.AvifExportParams) ([]byte, error) {
+	fake, ok := image.(*FakeImage)
+
+	if !ok {
+		return nil, ErrUnexpectedImage
+	}
+
+	sum := sha256.Sum256(fake.data)
+
+	return []byte(fmt.Sprintf("AVIF q=%d e=%d l=%t %x", params.Quality, params.Effort, params.Lossless, sum[:8])), nil
+}
+
+func init() {
+	ImageDecoder = FakeDecoder{}
+	ImageEncoder = FakeEncoder{}
+}
@@ -0,0 +1,155 @@
+//go:build fake
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errCollision = errors.New("output collides")
+
+func TestConvertImage(t *testing.T) {
+	large := strings.Repeat("x", 4096)
+
+	tests := []struct {
+		name        string
+		content     string
+		minSavings  Percent
+		prepare     func(job *Job)
+		wantErr     error
+		wantStatus  string
+		wantOutput  bool
+		wantRemoved bool
+	}{
+		{name: "converted", content: large, wantOutput: true, wantRemoved: true},
+		{name: "no gain", content: "tiny", minSavings: 0.05, wantStatus: StatusNoGain},
+		{name: "decode failure", content: "FAIL" + large, wantErr: ErrFakeFailure},
+		{name: "skipped", content: large, prepare: func(job *Job) { job.Error = errCollision }, wantErr: errCollision},
+		{name: "timed out before commit", content: large, prepare: func(job *Job) { job.expire() }, wantErr: ErrTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func(minSavings Percent) { MinSavings = minSavings }(MinSavings)
+
+			MinSavings = test.minSavings
+
+			root := writeTree(t, map[string]string{"image.png": test.content})
+			job := &Job{Root: root, Path: filepath.Join(root, "image.png")}
+
+			if test.prepare != nil {
+				test.prepare(job)
+			}
+
+			result, err := ConvertImage(job)
+
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("error %v, want %v", err, test.wantErr)
+			}
+
+			if err == nil && result.Status != test.wantStatus {
+				t.Errorf("status %q, want %q", result.Status, test.wantStatus)
+			}
+
+			if _, err := os.Stat(filepath.Join(root, "image.avif")); (err == nil) != test.wantOutput {
+				t.Errorf("output written: %t, want %t", err == nil, test.wantOutput)
+			}
+
+			if _, err := os.Stat(job.Path); (err != nil) != test.wantRemoved {
+				t.Errorf("original removed: %t, want %t", err != nil, test.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestCommitAfterExpire(t *testing.T) {
+	job := &Job{}
+
+	if err := job.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if job.expire() {
+		t.Error("a committed job expired")
+	}
+
+	job = &Job{}
+
+	if !job.expire() {
+		t.Error("a pending job didn't expire")
+	}
+
+	if err := job.Commit(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("commit of an expired job: %v, want %v", err, ErrTimeout)
+	}
+}
+
+// stallingDecoder never finishes images starting with STALL, and fails the
+// first decode of images starting with FLAKY the way libvips sometimes does.
+type stallingDecoder struct {
+	release chan struct{}
+	flaky   atomic.Int32
+}
+
+func (d *stallingDecoder) Decode(r io.Reader) (Image, error) {
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte("STALL")) {
+		<-d.release
+	}
+
+	if bytes.HasPrefix(data, []byte("FLAKY")) && d.flaky.Add(1) == 1 {
+		return nil, errors.New("VipsJpeg: out of order read at line 42")
+	}
+
+	return FakeDecoder{}.Decode(bytes.NewReader(data))
+}
+
+func TestRetryAfterTimeout(t *testing.T) {
+	decoder := &stallingDecoder{release: make(chan struct{})}
+
+	defer func(decoder Decoder, timeout time.Duration) { ImageDecoder, Timeout = decoder, timeout }(ImageDecoder, Timeout)
+	defer close(decoder.release)
+
+	ImageDecoder, Timeout = decoder, 50*time.Millisecond
+
+	large := strings.Repeat("x", 4096)
+	root := writeTree(t, map[string]string{"stall.png": "STALL" + large, "flaky.png": "FLAKY" + large})
+
+	if _, err := ConvertWithRetry(&Job{Root: root, Path: filepath.Join(root, "stall.png")}); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("stalled conversion: %v, want %v", err, ErrTimeout)
+	}
+
+	done := make(chan *Result, 1)
+
+	go func() {
+		result, err := ConvertWithRetry(&Job{Root: root, Path: filepath.Join(root, "flaky.png")})
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		done <- result
+	}()
+
+	select {
+	case result := <-done:
+		if result != nil && !result.Retried {
+			t.Error("flaky conversion wasn't retried")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retry waits for a conversion that timed out")
+	}
+}
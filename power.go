@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var PauseOnBattery = false
+
+var MinBattery = 0
+
+var PowerCheckInterval = 30 * time.Second
+
+var ErrNoPowerStatus = errors.New("power status is not available on this platform")
+
+type PowerStatus struct {
+	OnBattery bool
+	// Charge is the battery charge in percent, 100 without a battery.
+	Charge int
+}
+
+var lastPowerCheck time.Time
+
+// PauseReason tells why scheduling should wait, or returns an empty string
+// when it may go on.
+func PauseReason(status *PowerStatus) string {
+	if PauseOnBattery && status.OnBattery {
+		return "running on battery"
+	}
+
+	if MinBattery > 0 && status.OnBattery && status.Charge < MinBattery {
+		return fmt.Sprintf("battery at %d%%", status.Charge)
+	}
+
+	return ""
+}
+
+// WaitForPower blocks while the machine runs on battery or below the
+// charge threshold. The power status is read at most every
+// PowerCheckInterval, so calling it before every task is cheap.
+func WaitForPower(ctx context.Context) error {
+	if !PauseOnBattery && MinBattery == 0 {
+		return nil
+	}
+
+	paused := false
+
+	for {
+		if !paused && time.Since(lastPowerCheck) < PowerCheckInterval {
+			return nil
+		}
+
+		lastPowerCheck = time.Now()
+
+		status, err := ReadPowerStatus()
+
+		if err != nil {
+			return err
+		}
+
+		reason := PauseReason(status)
+
+		if reason == "" {
+			if paused {
+				RunObserver.OnPause("")
+			}
+
+			return nil
+		}
+
+		if !paused {
+			RunObserver.OnPause(reason)
+
+			paused = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(PowerCheckInterval):
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var pmsetCharge = regexp.MustCompile(`(\d+)%`)
+
+func ReadPowerStatus() (*PowerStatus, error) {
+	output, err := exec.Command("pmset", "-g", "batt").Output()
+
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PowerStatus{Charge: 100}
+
+	text := string(output)
+
+	status.OnBattery = strings.Contains(text, "'Battery Power'")
+
+	if match := pmsetCharge.FindStringSubmatch(text); match != nil {
+		status.Charge, _ = strconv.Atoi(match[1])
+	}
+
+	return status, nil
+}
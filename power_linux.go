@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const powerSupplyDir = "/sys/class/power_supply"
+
+func ReadPowerStatus() (*PowerStatus, error) {
+	status := &PowerStatus{Charge: 100}
+
+	entries, err := os.ReadDir(powerSupplyDir)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return status, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	read := func(dir, name string) string {
+		data, _ := os.ReadFile(filepath.Join(powerSupplyDir, dir, name))
+
+		return strings.TrimSpace(string(data))
+	}
+
+	online, batteries := false, 0
+
+	for _, entry := range entries {
+		switch read(entry.Name(), "type") {
+		case "Mains", "USB":
+			online = online || read(entry.Name(), "online") == "1"
+		case "Battery":
+			if read(entry.Name(), "scope") == "Device" {
+				continue
+			}
+
+			capacity, err := strconv.Atoi(read(entry.Name(), "capacity"))
+
+			if err != nil {
+				continue
+			}
+
+			if batteries == 0 {
+				status.Charge = capacity
+			} else {
+				status.Charge = min(status.Charge, capacity)
+			}
+
+			batteries += 1
+
+			if read(entry.Name(), "status") == "Discharging" {
+				status.OnBattery = true
+			}
+		}
+	}
+
+	status.OnBattery = batteries > 0 && (status.OnBattery || !online)
+
+	return status, nil
+}
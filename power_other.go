@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package main
+
+func ReadPowerStatus() (*PowerStatus, error) {
+	return nil, ErrNoPowerStatus
+}
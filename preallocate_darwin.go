@@ -0,0 +1,26 @@
+//go:build darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func Preallocate(file *os.File, size int64) error {
+	if size == 0 {
+		return nil
+	}
+
+	store := &unix.Fstore_t{Flags: unix.F_ALLOCATEALL, Posmode: unix.F_PEOFPOSMODE, Length: size}
+
+	err := unix.FcntlFstore(file.Fd(), unix.F_PREALLOCATE, store)
+
+	if errors.Is(err, unix.ENOTSUP) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func Preallocate(file *os.File, size int64) error {
+	if size == 0 {
+		return nil
+	}
+
+	err := unix.Fallocate(int(file.Fd()), 0, 0, size)
+
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) {
+		return nil
+	}
+
+	return err
+}
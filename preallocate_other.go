@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+import "os"
+
+func Preallocate(file *os.File, size int64) error {
+	return nil
+}
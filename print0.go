@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+var Print0 = false
+
+var print0Out io.Writer
+
+// StartPrint0 keeps stdout for the NUL-terminated records only, and sends
+// the progress and the summary to stderr.
+func StartPrint0() {
+	if !Print0 {
+		return
+	}
+
+	print0Out = os.Stdout
+	os.Stdout = os.Stderr
+
+	Progress = NewProgress(ConsoleANSI)
+}
+
+// PrintRecord0 writes a STATUS<tab>PATH record terminated by NUL.
+func PrintRecord0(status, path string) {
+	if print0Out == nil {
+		return
+	}
+
+	fmt.Fprintf(print0Out, "%s\t%s\x00", status, path)
+}
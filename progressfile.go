@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+var ProgressFile = ""
+
+var ProgressInterval = 5 * time.Second
+
+type ProgressState struct {
+	RunID    string    `json:"run_id"`
+	Updated  time.Time `json:"updated"`
+	Total    int       `json:"total"`
+	Done     int       `json:"done"`
+	Failed   int       `json:"failed"`
+	Workers  int       `json:"workers"`
+	ETA      float64   `json:"eta_seconds"`
+	Finished bool      `json:"finished"`
+}
+
+func WriteProgressFile(path string, state *ProgressState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// StartProgressFile rewrites path every ProgressInterval with the state
+// returned by snapshot, until the returned stop function is called.
+func StartProgressFile(path string, snapshot func() *ProgressState) func() {
+	started := time.Now()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	write := func(finished bool) {
+		state := snapshot()
+
+		state.RunID = RunID
+		state.Updated = time.Now()
+		state.Finished = finished
+
+		if state.Done > 0 && !finished {
+			elapsed := time.Since(started).Seconds()
+
+			state.ETA = elapsed / float64(state.Done) * float64(state.Total-state.Done)
+		}
+
+		WriteProgressFile(path, state)
+	}
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(ProgressInterval)
+
+		defer ticker.Stop()
+
+		write(false)
+
+		for {
+			select {
+			case <-ticker.C:
+				write(false)
+			case <-done:
+				write(true)
+
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+
+		<-stopped
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+var ProtectPatterns []string
+
+var ProtectXMP []string
+
+func IsProtected(path string, image Image) bool {
+	name := strings.ToLower(filepath.Base(path))
+
+	for _, pattern := range ProtectPatterns {
+		if matched, _ := filepath.Match(strings.ToLower(pattern), name); matched {
+			return true
+		}
+	}
+
+	if len(ProtectXMP) == 0 {
+		return false
+	}
+
+	ref, ok := image.(*vips.ImageRef)
+
+	if !ok {
+		return false
+	}
+
+	xmp := ref.GetBlob("xmp-data")
+
+	for _, marker := range ProtectXMP {
+		if bytes.Contains(xmp, []byte(marker)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/demiazz/avify/internal/vips"
+	"github.com/spf13/cobra"
+)
+
+const QueueName = "queue.json"
+
+type QueueEntry struct {
+	Root   string                 `json:"root"`
+	Path   string                 `json:"path"`
+	Params *vips.AvifExportParams `json:"params,omitempty"`
+
+	Repackage bool `json:"repackage,omitempty"`
+}
+
+type Queue struct {
+	Entries []*QueueEntry `json:"entries"`
+}
+
+func LoadQueue(path string) (*Queue, error) {
+	queue := &Queue{}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return queue, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, queue); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return queue, nil
+}
+
+func (q *Queue) Save(path string) error {
+	data, err := json.MarshalIndent(q, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// Add enqueues jobs not queued yet. Paths are stored absolute, so the queue
+// can be run from any working directory.
+func (q *Queue) Add(jobs []*Job) (int, error) {
+	queued := map[string]bool{}
+
+	for _, entry := range q.Entries {
+		queued[entry.Path] = true
+	}
+
+	added := 0
+
+	for _, job := range jobs {
+		root, err := filepath.Abs(job.Root)
+
+		if err != nil {
+			return added, err
+		}
+
+		path, err := filepath.Abs(job.Path)
+
+		if err != nil {
+			return added, err
+		}
+
+		if queued[path] {
+			continue
+		}
+
+		queued[path] = true
+
+		q.Entries = append(q.Entries, &QueueEntry{Root: root, Path: path, Params: job.Params, Repackage: job.Repackage})
+
+		added += 1
+	}
+
+	return added, nil
+}
+
+func (q *Queue) Jobs() []*Job {
+	jobs := make([]*Job, 0, len(q.Entries))
+
+	for _, entry := range q.Entries {
+		jobs = append(jobs, &Job{Root: entry.Root, Path: entry.Path, Params: entry.Params, Repackage: entry.Repackage})
+	}
+
+	return jobs
+}
+
+func (q *Queue) Remove(results []*Result) {
+	done := map[string]bool{}
+
+	for _, result := range results {
+		done[result.Path] = true
+	}
+
+	entries := q.Entries[:0]
+
+	for _, entry := range q.Entries {
+		if !done[entry.Path] {
+			entries = append(entries, entry)
+		}
+	}
+
+	q.Entries = entries
+}
+
+func NewQueueCmd() *cobra.Command {
+	var queuePath string
+
+	cmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Split a large batch across several runs with a persistent work queue",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.Root().PersistentPreRunE(cmd, args); err != nil {
+				return err
+			}
+
+			if queuePath != "" {
+				return nil
+			}
+
+			path, err := StatePath(QueueName)
+
+			if err != nil {
+				return err
+			}
+
+			queuePath = path
+
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&queuePath, "queue", "", "path of the queue `FILE` (default in the user state directory)")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add DIR",
+		Short: "Enqueue images found in DIR",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			queue, err := LoadQueue(queuePath)
+
+			if err != nil {
+				return err
+			}
+
+			discovery, err := FindImagesAt(args[0])
+
+			if err != nil {
+				return err
+			}
+
+			defer discovery.PrintSkipped()
+
+			added, err := queue.Add(discovery.Jobs)
+
+			if err != nil {
+				return err
+			}
+
+			if err := queue.Save(queuePath); err != nil {
+				return err
+			}
+
+			fmt.Printf("Enqueued %d images, %d in the queue\n", added, len(queue.Entries))
+
+			return nil
+		},
+	})
+
+	var duration time.Duration
+
+	run := &cobra.Command{
+		Use:   "run",
+		Short: "Convert queued images until the queue is empty or the time budget runs out",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			queue, err := LoadQueue(queuePath)
+
+			if err != nil {
+				return err
+			}
+
+			if len(queue.Entries) == 0 {
+				fmt.Println("Queue is empty")
+
+				return nil
+			}
+
+			ctx, cancel := InterruptContext(cmd.Context())
+
+			defer cancel()
+
+			if duration > 0 {
+				var cancel context.CancelFunc
+
+				ctx, cancel = context.WithTimeout(ctx, duration)
+
+				defer cancel()
+			}
+
+			jobs := queue.Jobs()
+
+			defer ApplySchedule(time.Now())()
+
+			PlanOutputs(jobs)
+
+			stats := ConvertImages(ctx, jobs)
+
+			queue.Remove(stats.Results)
+
+			if err := queue.Save(queuePath); err != nil {
+				return err
+			}
+
+			stats.PrintSummary()
+
+			fmt.Printf("Processed %d images, %d left in the queue\n", len(stats.Results), len(queue.Entries))
+
+			return nil
+		},
+	}
+
+	run.Flags().DurationVar(&duration, "duration", 0, "stop starting new conversions after this time budget (0 runs until the queue is empty)")
+
+	cmd.AddCommand(run)
+
+	return cmd
+}
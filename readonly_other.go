@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package main
+
+func IsReadOnly(path string) bool {
+	return false
+}
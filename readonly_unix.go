@@ -0,0 +1,17 @@
+//go:build linux || darwin
+
+package main
+
+import "syscall"
+
+const readOnlyMountFlag = 0x1
+
+func IsReadOnly(path string) bool {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return false
+	}
+
+	return int64(stat.Flags)&readOnlyMountFlag != 0
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+// ConvertRecovered turns a panic while converting job, e.g. on a libvips edge
+// case, into a failure of that file, so the rest of the batch goes on.
+func ConvertRecovered(job *Job) (result *Result, err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			result, err = nil, &PanicError{Value: value, Stack: debug.Stack()}
+		}
+	}()
+
+	return ConvertImage(job)
+}
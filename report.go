@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type Report struct {
+	RunID      string                    `json:"run_id"`
+	Runs       []string                  `json:"runs,omitempty"`
+	Generated  time.Time                 `json:"generated"`
+	SizeBefore uint64                    `json:"size_before"`
+	SizeAfter  uint64                    `json:"size_after"`
+	Replaced   *FormatStats              `json:"replaced"`
+	Added      *FormatStats              `json:"added"`
+	Failed     int                       `json:"failed"`
+	NoGain     []string                  `json:"no_gain,omitempty"`
+	Banding    []string                  `json:"banding,omitempty"`
+	Formats    map[string]*FormatStats   `json:"formats"`
+	Roots      map[string]*FormatStats   `json:"roots,omitempty"`
+	Cameras    map[string]*FormatStats   `json:"cameras,omitempty"`
+	Years      map[string]*FormatStats   `json:"years,omitempty"`
+	Trees      map[string]*TreeChecksums `json:"tree_checksums,omitempty"`
+	Skipped    map[SkipReason]int        `json:"skipped,omitempty"`
+	Histogram  *Histogram                `json:"histogram,omitempty"`
+	Timings    *Timings                  `json:"timings,omitempty"`
+	Conflicts  []string                  `json:"conflicts,omitempty"`
+	Files      []*Result                 `json:"files"`
+}
+
+func NewReport(discovery *Discovery, stats *Stats) *Report {
+	return &Report{
+		RunID:      RunID,
+		Generated:  time.Now(),
+		SizeBefore: stats.SizeBefore,
+		SizeAfter:  stats.SizeAfter,
+		Replaced:   &stats.Replaced,
+		Added:      &stats.Added,
+		Failed:     len(stats.Failed),
+		NoGain:     stats.NoGain,
+		Banding:    stats.Banding,
+		Formats:    stats.Formats,
+		Roots:      stats.Roots,
+		Cameras:    stats.Cameras,
+		Years:      stats.Years,
+		Trees:      stats.Trees,
+		Skipped:    discovery.Skipped,
+		Histogram:  discovery.Histogram,
+		Timings:    &stats.Timings,
+		Files:      stats.Results,
+	}
+}
+
+func (r *Report) Paths() []string {
+	paths := make([]string, len(r.Files))
+
+	for i, result := range r.Files {
+		paths[i] = result.Path
+	}
+
+	return paths
+}
+
+func (r *Report) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+func WriteReport(path string, discovery *Discovery, stats *Stats) error {
+	return NewReport(discovery, stats).Write(path)
+}
+
+func ReadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return report, nil
+}
+
+// MergeReports combines reports of shards or repeated runs. Files present in
+// several reports are conflicts; the entry from the latest report wins. The
+// totals are counted again from the files left, so conflicts count once.
+func MergeReports(reports []*Report) (*Report, *Stats) {
+	slices.SortStableFunc(reports, func(a, b *Report) int {
+		return a.Generated.Compare(b.Generated)
+	})
+
+	discovery := &Discovery{Skipped: map[SkipReason]int{}}
+	stats := &Stats{Formats: map[string]*FormatStats{}, Roots: map[string]*FormatStats{}}
+
+	files := map[string]*Result{}
+	seen := map[string]int{}
+
+	var order []string
+
+	var runs []string
+
+	var roots []string
+
+	for _, report := range reports {
+		if report.RunID != "" {
+			runs = append(runs, report.RunID)
+		}
+
+		runs = append(runs, report.Runs...)
+
+		for reason, count := range report.Skipped {
+			discovery.Skipped[reason] += count
+		}
+
+		for root := range report.Roots {
+			if !slices.Contains(roots, root) {
+				roots = append(roots, root)
+			}
+		}
+
+		for _, result := range report.Files {
+			if seen[result.Path] == 0 {
+				order = append(order, result.Path)
+			}
+
+			seen[result.Path] += 1
+			files[result.Path] = result
+		}
+	}
+
+	var conflicts []string
+
+	for _, path := range order {
+		result := files[path]
+
+		if seen[path] > 1 {
+			conflicts = append(conflicts, path)
+		}
+
+		stats.Results = append(stats.Results, result)
+
+		// Nested roots count their files under the innermost one.
+		var root string
+
+		for _, candidate := range roots {
+			if IsWithin(path, candidate) && len(candidate) > len(root) {
+				root = candidate
+			}
+		}
+
+		if result.Status == StatusNoGain {
+			stats.NoGain = append(stats.NoGain, path)
+
+			continue
+		}
+
+		if result.Status != StatusConverted {
+			stats.Failed = append(stats.Failed, path)
+			stats.Format(result.Format).Failed += 1
+
+			if root != "" {
+				stats.Root(root).Failed += 1
+			}
+
+			continue
+		}
+
+		stats.AddConverted(result)
+		stats.Format(result.Format).Add(result)
+
+		if root != "" {
+			stats.Root(root).Add(result)
+		}
+
+		if result.Protected {
+			stats.Protected = append(stats.Protected, path)
+		}
+
+		if result.Banding > 0 && result.Banding >= BandingThreshold {
+			stats.Banding = append(stats.Banding, path)
+		}
+	}
+
+	report := NewReport(discovery, stats)
+
+	report.Timings = nil
+	report.Runs = runs
+	report.Conflicts = conflicts
+
+	return report, stats
+}
+
+func NewReportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Work with JSON reports of previous runs",
+	}
+
+	var output string
+
+	merge := &cobra.Command{
+		Use:   "merge REPORT...",
+		Short: "Merge reports of sharded or repeated runs into one summary",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var reports []*Report
+
+			for _, path := range args {
+				report, err := ReadReport(path)
+
+				if err != nil {
+					return err
+				}
+
+				reports = append(reports, report)
+			}
+
+			report, stats := MergeReports(reports)
+
+			stats.PrintSummary()
+			stats.PrintGroups()
+
+			if len(report.Conflicts) > 0 {
+				fmt.Println("Following files appear in several reports, the latest entry is kept:")
+
+				for _, path := range report.Conflicts {
+					fmt.Printf("\t%s\n", path)
+				}
+			}
+
+			if output != "" {
+				return report.Write(output)
+			}
+
+			return nil
+		},
+	}
+
+	merge.Flags().StringVarP(&output, "output", "o", "", "write the merged report to `FILE`")
+
+	cmd.AddCommand(merge)
+
+	return cmd
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMergeReports(t *testing.T) {
+	dir := t.TempDir()
+	started := time.Now()
+
+	var reports []*Report
+
+	for i, files := range [][]*Result{
+		{
+			{Path: "photos/a.png", Format: "png", Status: StatusConverted, SizeBefore: 100, SizeAfter: 50},
+			{Path: "photos/b.png", Format: "png", Status: StatusFailed},
+		},
+		{
+			{Path: "photos/a.png", Format: "png", Status: StatusConverted, SizeBefore: 100, SizeAfter: 40},
+			{Path: "scans/c.png", Format: "png", Status: StatusConverted, SizeBefore: 100, SizeAfter: 20},
+		},
+	} {
+		stats := &Stats{Formats: map[string]*FormatStats{}, Roots: map[string]*FormatStats{}}
+
+		for _, result := range files {
+			stats.Results = append(stats.Results, result)
+
+			root := filepath.Dir(result.Path)
+
+			if result.Status == StatusConverted {
+				stats.Root(root).Add(result)
+			} else {
+				stats.Root(root).Failed += 1
+			}
+		}
+
+		report := NewReport(&Discovery{}, stats)
+		report.Generated = started.Add(time.Duration(i) * time.Second)
+
+		path := filepath.Join(dir, "report.json")
+
+		if err := report.Write(path); err != nil {
+			t.Fatal(err)
+		}
+
+		read, err := ReadReport(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := read.Roots["photos"].AverageRatio(), report.Roots["photos"].AverageRatio(); math.Abs(got-want) > 1e-9 {
+			t.Errorf("average ratio %v after reading, want %v", got, want)
+		}
+
+		reports = append(reports, read)
+	}
+
+	merged, _ := MergeReports(reports)
+
+	if !slices.Equal(merged.Conflicts, []string{"photos/a.png"}) {
+		t.Errorf("conflicts %v, want photos/a.png", merged.Conflicts)
+	}
+
+	photos := merged.Roots["photos"]
+
+	if photos == nil || photos.Count != 1 || photos.Failed != 1 || photos.SizeAfter != 40 || math.Abs(photos.AverageRatio()-0.4) > 1e-9 {
+		t.Errorf("photos %+v, want the latest a.png and the failed b.png", photos)
+	}
+
+	if scans := merged.Roots["scans"]; scans == nil || scans.Count != 1 || math.Abs(scans.AverageRatio()-0.2) > 1e-9 {
+		t.Errorf("scans %+v, want c.png", scans)
+	}
+}
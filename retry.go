@@ -0,0 +1,53 @@
+package main
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+var FlakyErrors = regexp.MustCompile(`out of order read|unable to read source|read error`)
+
+// Conversions share retryMu for reading. A retry takes it for writing, so it
+// runs alone once in-flight conversions drain, which avoids the concurrent
+// access patterns behind most spurious libvips failures. The lock is held by
+// the goroutine waiting for the conversion, not the one running it, so a
+// conversion that timed out but never ends doesn't hold it forever.
+var retryMu sync.RWMutex
+
+func IsFlaky(err error) bool {
+	return err != nil && FlakyErrors.MatchString(err.Error())
+}
+
+func ConvertWithRetry(job *Job) (*Result, error) {
+	result, err := convertShared(job)
+
+	if !IsFlaky(err) {
+		return result, err
+	}
+
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	// The retry is alone, so libvips can be made single-threaded for it
+	// without slowing down other conversions.
+	defer vips.ConcurrencySet(vips.ConcurrencyGet())
+
+	vips.ConcurrencySet(1)
+
+	result, err = ConvertWithTimeout(job)
+
+	if result != nil {
+		result.Retried = true
+	}
+
+	return result, err
+}
+
+func convertShared(job *Job) (*Result, error) {
+	retryMu.RLock()
+	defer retryMu.RUnlock()
+
+	return ConvertWithTimeout(job)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var RewriteRules []string
+
+type Rewrite struct {
+	From string
+	To   string
+}
+
+var rewrites []Rewrite
+
+// ParseRewrites reads rules like /mnt/masters=/mnt/web. The longest
+// matching prefix wins, so specific rules may refine broader ones.
+func ParseRewrites(rules []string) ([]Rewrite, error) {
+	parsed := make([]Rewrite, 0, len(rules))
+
+	for _, rule := range rules {
+		from, to, ok := strings.Cut(rule, "=")
+
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid rewrite rule %q, expected SRC-PREFIX=DST-PREFIX", rule)
+		}
+
+		parsed = append(parsed, Rewrite{From: filepath.Clean(from), To: filepath.Clean(to)})
+	}
+
+	slices.SortStableFunc(parsed, func(a, b Rewrite) int {
+		return cmp.Compare(len(b.From), len(a.From))
+	})
+
+	return parsed, nil
+}
+
+func RewritePath(path string) string {
+	for _, rewrite := range rewrites {
+		candidate := filepath.Clean(path)
+
+		if filepath.IsAbs(rewrite.From) && !filepath.IsAbs(candidate) {
+			if abs, err := filepath.Abs(candidate); err == nil {
+				candidate = abs
+			}
+		}
+
+		if candidate == rewrite.From {
+			return rewrite.To
+		}
+
+		if rest, ok := strings.CutPrefix(candidate, rewrite.From+string(filepath.Separator)); ok {
+			return filepath.Join(rewrite.To, rest)
+		}
+	}
+
+	return path
+}
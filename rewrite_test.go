@@ -0,0 +1,66 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseRewrites(t *testing.T) {
+	tests := []struct {
+		rules []string
+		want  []Rewrite
+		fails bool
+	}{
+		{rules: nil, want: []Rewrite{}},
+		{rules: []string{"/mnt/masters/=/mnt/web"}, want: []Rewrite{{From: "/mnt/masters", To: "/mnt/web"}}},
+		{
+			rules: []string{"/mnt=/web", "/mnt/masters/raw=/web/raw", "/mnt/masters=/web/masters"},
+			want:  []Rewrite{{From: "/mnt/masters/raw", To: "/web/raw"}, {From: "/mnt/masters", To: "/web/masters"}, {From: "/mnt", To: "/web"}},
+		},
+		{rules: []string{"/mnt/masters"}, fails: true},
+		{rules: []string{"=/mnt/web"}, fails: true},
+		{rules: []string{"/mnt/masters="}, fails: true},
+	}
+
+	for _, test := range tests {
+		for i := range test.want {
+			test.want[i] = Rewrite{From: filepath.FromSlash(test.want[i].From), To: filepath.FromSlash(test.want[i].To)}
+		}
+
+		got, err := ParseRewrites(test.rules)
+
+		if test.fails {
+			if err == nil {
+				t.Errorf("%q: no error", test.rules)
+			}
+
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: %v, %v, want %v", test.rules, got, err, test.want)
+		}
+	}
+}
+
+func TestRewritePath(t *testing.T) {
+	defer func(saved []Rewrite) { rewrites = saved }(rewrites)
+
+	var err error
+
+	if rewrites, err = ParseRewrites([]string{"/mnt=/web", "/mnt/masters=/srv/masters"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		"/mnt/masters/a.avif": "/srv/masters/a.avif",
+		"/mnt/other/a.avif":   "/web/other/a.avif",
+		"/mnt":                "/web",
+		"/mntx/a.avif":        "/mntx/a.avif",
+	} {
+		if got := RewritePath(filepath.FromSlash(path)); got != filepath.FromSlash(want) {
+			t.Errorf("%s: %s, want %s", path, got, want)
+		}
+	}
+}
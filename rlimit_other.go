@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+func FileLimit() (uint64, error) {
+	return 0, nil
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// FileLimit is the soft limit of open files. The Go runtime already raised it
+// to the hard limit at startup, so this is as high as it gets.
+func FileLimit() (uint64, error) {
+	var limit syscall.Rlimit
+
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, err
+	}
+
+	return uint64(limit.Cur), nil
+}
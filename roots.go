@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// DedupeRoots drops roots given twice, also through another spelling or a
+// symlink, and roots nested in another root, which would be converted twice.
+func DedupeRoots(roots []string) []string {
+	resolved := make([]string, len(roots))
+
+	for i, root := range roots {
+		resolved[i] = root
+
+		if abs, err := filepath.Abs(root); err == nil {
+			resolved[i] = abs
+		}
+
+		if real, err := filepath.EvalSymlinks(resolved[i]); err == nil {
+			resolved[i] = real
+		}
+	}
+
+	var kept []string
+
+	for i, root := range roots {
+		covered := -1
+
+		for j := range roots {
+			// A root given as a glob covers only part of its tree.
+			if i == j || rootGlobs[roots[j]] != nil || !IsWithin(resolved[i], resolved[j]) {
+				continue
+			}
+
+			// Of two equal roots the first one is kept.
+			if resolved[i] != resolved[j] || j < i {
+				covered = j
+
+				break
+			}
+		}
+
+		if covered >= 0 {
+			fmt.Printf("Skipping %s, already covered by %s\n", root, roots[covered])
+
+			continue
+		}
+
+		kept = append(kept, root)
+	}
+
+	return kept
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Percent is a share parsed from values like 5% or 5, stored as a fraction.
+type Percent float64
+
+func (p *Percent) String() string {
+	return strconv.FormatFloat(float64(*p)*100, 'g', -1, 64) + "%"
+}
+
+func (p *Percent) Set(value string) error {
+	text := strings.TrimSuffix(strings.TrimSpace(value), "%")
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+
+	if err != nil || n < 0 || n > 100 {
+		return fmt.Errorf("invalid percentage %q", value)
+	}
+
+	*p = Percent(n / 100)
+
+	return nil
+}
+
+func (p *Percent) Type() string {
+	return "percent"
+}
+
+var MinSavings Percent
+
+// HasGain tells whether an output of after bytes saves at least MinSavings
+// of the source. An output that is not smaller never has a gain.
+func HasGain(before, after uint64) bool {
+	if after >= before {
+		return false
+	}
+
+	return float64(before-after)/float64(before) >= float64(MinSavings)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHasGain(t *testing.T) {
+	defer func(saved Percent) { MinSavings = saved }(MinSavings)
+
+	for _, test := range []struct {
+		min           Percent
+		before, after uint64
+		want          bool
+	}{
+		{0, 100, 99, true},
+		{0, 100, 100, false},
+		{0, 100, 150, false},
+		{0.05, 100, 95, true},
+		{0.05, 100, 96, false},
+		{0.05, 100, 120, false},
+	} {
+		MinSavings = test.min
+
+		if got := HasGain(test.before, test.after); got != test.want {
+			t.Errorf("HasGain(%d, %d) with --min-savings %v = %v, want %v", test.before, test.after, float64(test.min), got, test.want)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Percent
+		fails bool
+	}{
+		{value: "5%", want: 0.05},
+		{value: "5", want: 0.05},
+		{value: " 12.5 % ", want: 0.125},
+		{value: "0", want: 0},
+		{value: "100%", want: 1},
+		{value: "101%", fails: true},
+		{value: "-1", fails: true},
+		{value: "five", fails: true},
+	}
+
+	for _, test := range tests {
+		var p Percent
+
+		err := p.Set(test.value)
+
+		if test.fails {
+			if err == nil {
+				t.Errorf("%q: no error", test.value)
+			}
+
+			continue
+		}
+
+		if err != nil || math.Abs(float64(p-test.want)) > 1e-9 {
+			t.Errorf("%q: %v, %v, want %v", test.value, float64(p), err, float64(test.want))
+		}
+	}
+
+	if p := Percent(0.05); p.String() != "5%" {
+		t.Errorf("String() = %q, want 5%%", p.String())
+	}
+}
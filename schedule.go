@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+// WindowSettings override the effort and the number of workers during a time
+// of day, parsed from values like effort=3,jobs=2. Unset fields are -1 and
+// keep the value given otherwise.
+type WindowSettings struct {
+	Effort int
+	Jobs   int
+}
+
+func (s *WindowSettings) String() string {
+	var parts []string
+
+	if s.Effort >= 0 {
+		parts = append(parts, "effort="+strconv.Itoa(s.Effort))
+	}
+
+	if s.Jobs >= 0 {
+		parts = append(parts, "jobs="+strconv.Itoa(s.Jobs))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (s *WindowSettings) Set(value string) error {
+	settings := WindowSettings{Effort: -1, Jobs: -1}
+
+	for _, part := range strings.Split(value, ",") {
+		key, text, ok := strings.Cut(strings.TrimSpace(part), "=")
+		n, err := strconv.Atoi(text)
+
+		switch {
+		case !ok || err != nil:
+			return fmt.Errorf("invalid setting %q, expected effort=N or jobs=N", part)
+		case key == "effort" && n >= 0 && n <= 9:
+			settings.Effort = n
+		case key == "jobs" && n >= 1:
+			settings.Jobs = n
+		default:
+			return fmt.Errorf("invalid setting %q", part)
+		}
+	}
+
+	*s = settings
+
+	return nil
+}
+
+func (s *WindowSettings) Type() string {
+	return "settings"
+}
+
+var (
+	DaytimeSettings = WindowSettings{Effort: -1, Jobs: -1}
+	NightSettings   = WindowSettings{Effort: -1, Jobs: -1}
+
+	DayHours = "8-20"
+
+	dayStart, dayEnd int
+)
+
+func CheckSchedule() error {
+	start, end, ok := strings.Cut(DayHours, "-")
+
+	first, err := strconv.Atoi(start)
+	last, lastErr := strconv.Atoi(end)
+
+	if !ok || err != nil || lastErr != nil || first < 0 || last > 24 || first >= last {
+		return fmt.Errorf("invalid day hours %q, expected e.g. 8-20", DayHours)
+	}
+
+	dayStart, dayEnd = first, last
+
+	return nil
+}
+
+// ScheduledSettings are the settings of the window now falls into.
+func ScheduledSettings(now time.Time) WindowSettings {
+	if hour := now.Hour(); hour >= dayStart && hour < dayEnd {
+		return DaytimeSettings
+	}
+
+	return NightSettings
+}
+
+// ApplySchedule applies the settings of the window now falls into to one
+// batch of watch, the daemon or queue run, and returns the function putting
+// the flags back. Directories with their own effort in settings keep it.
+func ApplySchedule(now time.Time) func() {
+	settings := ScheduledSettings(now)
+	effort, jobs := AvifExportParams.Effort, Concurrency
+
+	if settings.Effort >= 0 {
+		AvifExportParams.Effort = settings.Effort
+	}
+
+	// Like --jobs, the number is capped by the open files limit and also
+	// sets the libvips thread count.
+	if settings.Jobs >= 1 {
+		Concurrency = min(settings.Jobs, MaxConcurrency)
+
+		if !Deterministic {
+			vips.ConcurrencySet(Concurrency)
+		}
+	}
+
+	return func() {
+		AvifExportParams.Effort, Concurrency = effort, jobs
+
+		if settings.Jobs >= 1 && !Deterministic {
+			vips.ConcurrencySet(jobs)
+		}
+	}
+}
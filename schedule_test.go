@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowSettings(t *testing.T) {
+	tests := []struct {
+		value string
+		want  WindowSettings
+		err   bool
+	}{
+		{value: "effort=3,jobs=2", want: WindowSettings{Effort: 3, Jobs: 2}},
+		{value: "jobs=16", want: WindowSettings{Effort: -1, Jobs: 16}},
+		{value: "effort=0", want: WindowSettings{Effort: 0, Jobs: -1}},
+		{value: "effort=10", err: true},
+		{value: "jobs=0", err: true},
+		{value: "speed=3", err: true},
+		{value: "effort", err: true},
+	}
+
+	for _, test := range tests {
+		settings := WindowSettings{Effort: -1, Jobs: -1}
+		err := settings.Set(test.value)
+
+		if (err != nil) != test.err {
+			t.Errorf("%q: error %v", test.value, err)
+		}
+
+		if err == nil && settings != test.want {
+			t.Errorf("%q: %+v, want %+v", test.value, settings, test.want)
+		}
+	}
+}
+
+func TestScheduledSettings(t *testing.T) {
+	defer func(day, night WindowSettings, hours string) {
+		DaytimeSettings, NightSettings, DayHours = day, night, hours
+	}(DaytimeSettings, NightSettings, DayHours)
+
+	DaytimeSettings = WindowSettings{Effort: 3, Jobs: 2}
+	NightSettings = WindowSettings{Effort: 7, Jobs: 16}
+	DayHours = "8-20"
+
+	if err := CheckSchedule(); err != nil {
+		t.Fatal(err)
+	}
+
+	for hour, want := range map[int]WindowSettings{0: NightSettings, 7: NightSettings, 8: DaytimeSettings, 19: DaytimeSettings, 20: NightSettings} {
+		if got := ScheduledSettings(time.Date(2024, 1, 1, hour, 30, 0, 0, time.Local)); got != want {
+			t.Errorf("%d:30: %+v, want %+v", hour, got, want)
+		}
+	}
+}
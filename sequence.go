@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/demiazz/avify/internal/vips"
+	"github.com/spf13/cobra"
+)
+
+var ErrNoFrames = errors.New("no frames match the pattern")
+
+func CompareNatural(a, b string) int {
+	for len(a) > 0 && len(b) > 0 {
+		na, ra := leadingDigits(a)
+		nb, rb := leadingDigits(b)
+
+		if na != "" && nb != "" {
+			x, _ := strconv.ParseUint(na, 10, 64)
+			y, _ := strconv.ParseUint(nb, 10, 64)
+
+			if x != y {
+				if x < y {
+					return -1
+				}
+
+				return 1
+			}
+
+			a, b = ra, rb
+
+			continue
+		}
+
+		if a[0] != b[0] {
+			if a[0] < b[0] {
+				return -1
+			}
+
+			return 1
+		}
+
+		a, b = a[1:], b[1:]
+	}
+
+	return len(a) - len(b)
+}
+
+func leadingDigits(s string) (string, string) {
+	i := 0
+
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+
+	return s[:i], s[i:]
+}
+
+func AssembleSequence(paths []string, fps float64) ([]byte, error) {
+	if len(paths) == 0 {
+		return nil, ErrNoFrames
+	}
+
+	frames := make([]*vips.ImageRef, 0, len(paths))
+
+	defer func() {
+		for _, frame := range frames {
+			frame.Close()
+		}
+	}()
+
+	for _, path := range paths {
+		frame, err := vips.NewImageFromFile(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		frames = append(frames, frame)
+
+		if frame.Width() != frames[0].Width() || frame.Height() != frames[0].Height() {
+			return nil, fmt.Errorf("%s: frame size %dx%d differs from %dx%d", path, frame.Width(), frame.Height(), frames[0].Width(), frames[0].Height())
+		}
+	}
+
+	height := frames[0].Height()
+
+	animation, err := frames[0].Copy()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer animation.Close()
+
+	if err := animation.ArrayJoin(frames[1:], 1); err != nil {
+		return nil, err
+	}
+
+	if err := animation.SetPageHeight(height); err != nil {
+		return nil, err
+	}
+
+	delays := make([]int, len(frames))
+
+	for i := range delays {
+		delays[i] = int(1000 / fps)
+	}
+
+	if err := animation.SetPageDelay(delays); err != nil {
+		return nil, err
+	}
+
+	animation.SetInt("loop", 0)
+
+	return ExportAvif(animation, AvifExportParams)
+}
+
+func NewSequenceCmd() *cobra.Command {
+	var output string
+	var fps float64
+
+	cmd := &cobra.Command{
+		Use:   "sequence PATTERN",
+		Short: "Assemble numbered frames matching PATTERN into a single animated AVIF",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if fps <= 0 {
+				return fmt.Errorf("invalid fps %v", fps)
+			}
+
+			paths, err := filepath.Glob(args[0])
+
+			if err != nil {
+				return err
+			}
+
+			slices.SortFunc(paths, CompareNatural)
+
+			bytes, err := AssembleSequence(paths, fps)
+
+			if err != nil {
+				return err
+			}
+
+			if err := ImageSink.Write(output, bytes); err != nil {
+				return err
+			}
+
+			fmt.Printf("Assembled %d frames into %s (%s)\n", len(paths), output, FormatBytes(uint64(len(bytes))))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "path of the animated AVIF to write")
+	cmd.Flags().Float64Var(&fps, "fps", 24, "frames per second")
+
+	cmd.MarkFlagRequired("output")
+
+	return cmd
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/demiazz/avify/internal/vips"
+)
+
+const (
+	RCFileName   = ".avifyrc"
+	TOMLFileName = ".avify.toml"
+)
+
+// SettingsFileNames are read in order, so .avify.toml wins over .avifyrc in
+// the same directory.
+var SettingsFileNames = []string{RCFileName, TOMLFileName}
+
+func IsSettingsFile(name string) bool {
+	return slices.Contains(SettingsFileNames, name)
+}
+
+type Settings map[string]string
+
+func ParseSettings(r io.Reader) (Settings, error) {
+	settings := Settings{}
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		if !strings.HasPrefix(value, `"`) && !strings.HasPrefix(value, "[") {
+			value, _, _ = strings.Cut(value, "#")
+			value = strings.TrimSpace(value)
+		}
+
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+
+		settings[key] = value
+	}
+
+	return settings, scanner.Err()
+}
+
+// ParseTOMLSettings decodes an .avify.toml file. Arrays become comma separated
+// lists, the way they are written in .avifyrc.
+func ParseTOMLSettings(r io.Reader) (Settings, error) {
+	values, err := ParseTOMLValues(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	settings := Settings{}
+
+	for key, items := range values {
+		settings[key] = strings.Join(items, ",")
+	}
+
+	return settings, nil
+}
+
+// ParseTOMLValues decodes a flat TOML file into the values of every key, one
+// for plain values and the items of arrays.
+func ParseTOMLValues(r io.Reader) (map[string][]string, error) {
+	var decoded map[string]any
+
+	if _, err := toml.NewDecoder(r).Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	values := map[string][]string{}
+
+	for key, value := range decoded {
+		switch value := value.(type) {
+		case map[string]any, []map[string]any:
+			return nil, fmt.Errorf("%s: tables aren't settings", key)
+		case []any:
+			items := make([]string, len(value))
+
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+
+			values[key] = items
+		default:
+			values[key] = []string{fmt.Sprint(value)}
+		}
+	}
+
+	return values, nil
+}
+
+func LoadSettings(path string) (Settings, error) {
+	file, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	parse := ParseSettings
+
+	if filepath.Base(path) == TOMLFileName {
+		parse = ParseTOMLSettings
+	}
+
+	settings, err := parse(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return settings, nil
+}
+
+// LoadDirSettings merges the settings files of dir. The returned path names
+// the files for error messages.
+func LoadDirSettings(dir string) (Settings, string, error) {
+	var merged Settings
+
+	var paths []string
+
+	for _, name := range SettingsFileNames {
+		path := filepath.Join(dir, name)
+
+		settings, err := LoadSettings(path)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if settings == nil {
+			continue
+		}
+
+		if merged == nil {
+			merged = Settings{}
+		}
+
+		maps.Copy(merged, settings)
+
+		paths = append(paths, path)
+	}
+
+	return merged, strings.Join(paths, ", "), nil
+}
+
+// ApplySettings overrides the params and the formats inherited from the parent
+// directory. Nil formats convert every format.
+func ApplySettings(params *vips.AvifExportParams, formats []string, settings Settings) (*vips.AvifExportParams, []string, bool, error) {
+	overridden := *params
+	skip := false
+
+	for key, value := range settings {
+		var err error
+
+		switch key {
+		case "quality":
+			overridden.Quality, err = parseBoundedInt(value, 1, 100)
+		case "effort":
+			overridden.Effort, err = parseBoundedInt(value, 0, 9)
+		case "lossless":
+			overridden.Lossless, err = strconv.ParseBool(value)
+		case "skip":
+			skip, err = strconv.ParseBool(value)
+		case "format":
+			formats, err = parseFormats(value)
+		default:
+			err = errors.New("unknown setting")
+		}
+
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("%s = %s: %w", key, value, err)
+		}
+	}
+
+	return &overridden, formats, skip, nil
+}
+
+func parseFormats(value string) ([]string, error) {
+	var formats []string
+
+	for _, format := range strings.Split(value, ",") {
+		format = normalizeExt(strings.TrimSpace(format))
+
+		if !slices.Contains(knownExtensions, format) {
+			return nil, fmt.Errorf("unsupported format %q, expected one of %s", format, strings.Join(knownExtensions, ", "))
+		}
+
+		formats = append(formats, format)
+	}
+
+	return formats, nil
+}
+
+func parseBoundedInt(value string, low, high int) (int, error) {
+	n, err := strconv.Atoi(value)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if n < low || n > high {
+		return 0, fmt.Errorf("must be between %d and %d", low, high)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseTOMLSettings(t *testing.T) {
+	settings, err := ParseTOMLSettings(strings.NewReader(`
+# scans
+quality = 60
+lossless = false
+format = ["jpg", "png"] # both
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Settings{"quality": "60", "lossless": "false", "format": "jpg,png"}
+
+	if !maps.Equal(settings, want) {
+		t.Errorf("parsed %v, want %v", settings, want)
+	}
+
+	for _, text := range []string{"[scans]\nquality = 60\n", "quality = \n"} {
+		if _, err := ParseTOMLSettings(strings.NewReader(text)); err == nil {
+			t.Errorf("%q parsed", text)
+		}
+	}
+}
+
+func TestSettingsFormat(t *testing.T) {
+	image, err := os.ReadFile(filepath.Join("testdata", "complete.png"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := writeTree(t, map[string]string{
+		"a.png":                   string(image),
+		"scans/" + TOMLFileName:   "format = [\"jpg\"]\nquality = 60\n",
+		"scans/b.png":             string(image),
+		"scans/nested/c.png":      string(image),
+		"scans/art/" + RCFileName: "format = png\n",
+		"scans/art/d.png":         string(image),
+		"photos/" + TOMLFileName:  "quality = 90\n",
+		"photos/e.png":            string(image),
+		"broken/" + TOMLFileName:  "format = [\"bmp\"]\n",
+	})
+
+	if _, err := FindImagesAt(root); err == nil {
+		t.Error("an unsupported format was accepted")
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "broken")); err != nil {
+		t.Fatal(err)
+	}
+
+	discovery, err := FindImagesAt(root)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{filepath.Join(root, "a.png"), filepath.Join(root, "photos", "e.png"), filepath.Join(root, "scans", "art", "d.png")}
+
+	if got := jobPaths(discovery); !slices.Equal(got, want) {
+		t.Errorf("found %v, want %v", got, want)
+	}
+
+	if discovery.Skipped[SkipFormat] != 2 {
+		t.Errorf("skipped %d files by format, want 2", discovery.Skipped[SkipFormat])
+	}
+
+	for _, job := range discovery.Jobs {
+		if job.Path == want[1] && job.Params.Quality != 90 || job.Path == want[2] && job.Params.Quality != 60 {
+			t.Errorf("%s converted with quality %d", job.Path, job.Params.Quality)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+type Megapixels int
+
+func (m *Megapixels) String() string {
+	return fmt.Sprintf("%gMP", float64(*m)/1e6)
+}
+
+func (m *Megapixels) Set(value string) error {
+	pixels, err := ParseMegapixels(value)
+
+	if err != nil {
+		return err
+	}
+
+	*m = Megapixels(pixels)
+
+	return nil
+}
+
+func (m *Megapixels) Type() string {
+	return "pixels"
+}
+
+func ParseMegapixels(value string) (int, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	scale := 1.0
+
+	if number, ok := strings.CutSuffix(text, "MP"); ok {
+		text = strings.TrimSpace(number)
+		scale = 1e6
+	}
+
+	n, err := strconv.ParseFloat(text, 64)
+
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid pixel count %q", value)
+	}
+
+	return int(n * scale), nil
+}
+
+var SmallQuality = 0
+
+var LargeQuality = 0
+
+var SmallThreshold = Megapixels(1e6)
+
+var LargeThreshold = Megapixels(8e6)
+
+func SizeClassParams(params *vips.AvifExportParams, width, height int) *vips.AvifExportParams {
+	pixels := width * height
+	quality := 0
+
+	if SmallQuality > 0 && pixels < int(SmallThreshold) {
+		quality = SmallQuality
+	}
+
+	if LargeQuality > 0 && pixels >= int(LargeThreshold) {
+		quality = LargeQuality
+	}
+
+	if quality == 0 || quality == params.Quality {
+		return params
+	}
+
+	classified := *params
+
+	classified.Quality = quality
+
+	return &classified
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestParseMegapixels(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		fails bool
+	}{
+		{value: "2MP", want: 2000000},
+		{value: "0.5mp", want: 500000},
+		{value: " 1.5 MP ", want: 1500000},
+		{value: "640000", want: 640000},
+		{value: "0", want: 0},
+		{value: "-1MP", fails: true},
+		{value: "MP", fails: true},
+		{value: "big", fails: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseMegapixels(test.value)
+
+		if test.fails {
+			if err == nil {
+				t.Errorf("%q: no error", test.value)
+			}
+
+			continue
+		}
+
+		if err != nil || got != test.want {
+			t.Errorf("%q: %d, %v, want %d", test.value, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"github.com/demiazz/avify/internal/vips"
+)
+
+var TargetSSIM = 0.0
+
+const (
+	ssimWindow     = 8
+	ssimMinQuality = 20
+	ssimMaxQuality = 95
+)
+
+// SSIM is the mean structural similarity of two grayscale samples over
+// non-overlapping 8x8 windows.
+func SSIM(a, b []byte, width, height int) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+
+	var sum float64
+	var windows int
+
+	for y := 0; y+ssimWindow <= height; y += ssimWindow {
+		for x := 0; x+ssimWindow <= width; x += ssimWindow {
+			var sa, sb, saa, sbb, sab float64
+
+			for dy := 0; dy < ssimWindow; dy++ {
+				for dx := 0; dx < ssimWindow; dx++ {
+					i := (y+dy)*width + x + dx
+					va, vb := float64(a[i]), float64(b[i])
+
+					sa += va
+					sb += vb
+					saa += va * va
+					sbb += vb * vb
+					sab += va * vb
+				}
+			}
+
+			n := float64(ssimWindow * ssimWindow)
+			ma, mb := sa/n, sb/n
+			va := saa/n - ma*ma
+			vb := sbb/n - mb*mb
+			cov := sab/n - ma*mb
+
+			sum += (2*ma*mb + c1) * (2*cov + c2) / ((ma*ma + mb*mb + c1) * (va + vb + c2))
+			windows += 1
+		}
+	}
+
+	if windows == 0 {
+		return 1
+	}
+
+	return sum / float64(windows)
+}
+
+func encodedSSIM(before []byte, width, height int, encoded []byte) (float64, error) {
+	output, err := vips.NewImageFromBuffer(encoded)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer output.Close()
+
+	after, outputWidth, outputHeight, err := GrayscaleSample(output)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if width != outputWidth || height != outputHeight || len(before) != len(after) {
+		return 0, ErrSampleMismatch
+	}
+
+	return SSIM(before, after, width, height), nil
+}
+
+// SearchQuality binary-searches the lowest quality whose output reaches
+// TargetSSIM against the source, falling back to the highest searched quality.
+func SearchQuality(source *vips.ImageRef, params *vips.AvifExportParams) ([]byte, int, error) {
+	before, width, height, err := GrayscaleSample(source)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var best []byte
+
+	bestQuality := 0
+	low, high := ssimMinQuality, ssimMaxQuality
+
+	for low <= high {
+		quality := (low + high) / 2
+		candidate := *params
+
+		candidate.Quality = quality
+
+		bytes, err := ExportAvif(source, &candidate)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		score, err := encodedSSIM(before, width, height, bytes)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if score >= TargetSSIM {
+			best, bestQuality = bytes, quality
+			high = quality - 1
+		} else {
+			low = quality + 1
+		}
+	}
+
+	if best != nil {
+		return best, bestQuality, nil
+	}
+
+	fallback := *params
+
+	fallback.Quality = ssimMaxQuality
+
+	bytes, err := ExportAvif(source, &fallback)
+
+	return bytes, ssimMaxQuality, err
+}
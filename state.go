@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateMaxAge is how long checkpoints, manifests and known-bad entries stay
+// in the state directory after they were last used.
+var StateMaxAge = 30 * 24 * time.Hour
+
+func StateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "avify"), nil
+	}
+
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".local", "state", "avify"), nil
+}
+
+func StatePath(name string) (string, error) {
+	dir, err := StateDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, name), nil
+}
+
+// PruneState removes what the state directory keeps for trees and files
+// avify hasn't seen for StateMaxAge, so running it for years, or as a
+// daemon, doesn't slowly fill the directory.
+func PruneState() error {
+	if StateMaxAge <= 0 {
+		return nil
+	}
+
+	dir, err := StateDir()
+
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-StateMaxAge)
+
+	for _, entry := range entries {
+		checkpoint, _ := filepath.Match(CheckpointName+"-*.json", entry.Name())
+		manifest, _ := filepath.Match("manifest-*.json", entry.Name())
+
+		if !checkpoint && !manifest {
+			continue
+		}
+
+		info, err := entry.Info()
+
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	list, path, err := LoadKnownBad()
+
+	if err != nil {
+		return err
+	}
+
+	if list.Prune(cutoff) == 0 {
+		return nil
+	}
+
+	return list.Save(path)
+}
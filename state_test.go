@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPruneState(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	dir, err := StateDir()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * StateMaxAge)
+
+	for name, modified := range map[string]time.Time{
+		"checkpoint-old.json": old,
+		"checkpoint-new.json": time.Now(),
+		"manifest-old.json":   old,
+		"queue.json":          old,
+	} {
+		path, err := StatePath(name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := KnownBadList{
+		"old": {Path: "old.jpg", LastSeen: old},
+		"new": {Path: "new.jpg", LastSeen: time.Now()},
+	}
+
+	if err := list.Save(filepath.Join(dir, KnownBadName)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PruneState(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	if want := []string{"checkpoint-new.json", KnownBadName, "queue.json"}; !slices.Equal(names, want) {
+		t.Errorf("state directory has %v, want %v", names, want)
+	}
+
+	list, _, err = LoadKnownBad()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := list["old"]; ok || len(list) != 1 {
+		t.Errorf("known-bad files %v, want only new.jpg", list)
+	}
+}
+
+func TestManifestPath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	defer func(output string) { OutputDir = output }(OutputDir)
+
+	dir, err := StateDir()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+
+	OutputDir = ""
+
+	if path, err := ManifestPath(root); err != nil || path != filepath.Join(root, ManifestName) {
+		t.Errorf("manifest at %s (%v), want it under the root", path, err)
+	}
+
+	var paths []string
+
+	for _, output := range []string{"out", "other"} {
+		OutputDir = filepath.Join(t.TempDir(), output)
+
+		path, err := ManifestPath(root)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if filepath.Dir(path) != dir {
+			t.Errorf("manifest of --output %s at %s, want it in the state directory", OutputDir, path)
+		}
+
+		paths = append(paths, path)
+	}
+
+	if paths[0] == paths[1] {
+		t.Error("output directories share a manifest")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+type RunStatus struct {
+	Started time.Time
+	Total   int
+	Done    int
+	Failed  int
+	Workers int
+	Running map[*Job]time.Time
+}
+
+func (s *RunStatus) Print(w io.Writer) {
+	var mem runtime.MemStats
+	var vipsMem vips.MemoryStats
+
+	runtime.ReadMemStats(&mem)
+	vips.ReadVipsMemStats(&vipsMem)
+
+	fmt.Fprintf(w, "Elapsed: %s\n", time.Since(s.Started).Round(time.Second))
+	fmt.Fprintf(w, "Done: %d of %d, %d failed\n", s.Done, s.Total, s.Failed)
+	fmt.Fprintf(w, "Memory: Go heap %s, libvips %s (peak %s), %d files open in libvips\n", FormatBytes(mem.HeapAlloc), FormatBytes(uint64(vipsMem.Mem)), FormatBytes(uint64(vipsMem.MemHigh)), vipsMem.Files)
+	fmt.Fprintf(w, "Converting with %d workers:\n", s.Workers)
+
+	jobs := make([]*Job, 0, len(s.Running))
+
+	for job := range s.Running {
+		jobs = append(jobs, job)
+	}
+
+	slices.SortFunc(jobs, func(a, b *Job) int {
+		return s.Running[a].Compare(s.Running[b])
+	})
+
+	for _, job := range jobs {
+		fmt.Fprintf(w, "\t%s (%s)\n", job.Path, time.Since(s.Running[job]).Round(time.Second))
+	}
+}
+
+var (
+	statusMu      sync.Mutex
+	currentStatus func() *RunStatus
+)
+
+// PrintStatus prints the status of the conversions running now to w, and
+// tells whether there were any.
+func PrintStatus(w io.Writer) bool {
+	statusMu.Lock()
+	status := currentStatus
+	statusMu.Unlock()
+
+	if status == nil {
+		return false
+	}
+
+	status().Print(w)
+
+	return true
+}
+
+// NotifyStatus prints the status to stderr on SIGINFO (Ctrl-T), without
+// interrupting the run. Other systems have no signal to spare: SIGUSR1 and
+// SIGUSR2 change the number of workers, and the daemon reports the status to
+// avify ctl status instead.
+func NotifyStatus() {
+	if len(statusSignals) == 0 {
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, statusSignals...)
+
+	go func() {
+		for range signals {
+			if !PrintStatus(os.Stderr) {
+				fmt.Fprintln(os.Stderr, "Not converting anything at the moment")
+			}
+		}
+	}()
+}
+
+// ReportStatus makes PrintStatus print status until the returned function is
+// called.
+func ReportStatus(status func() *RunStatus) func() {
+	statusMu.Lock()
+	previous := currentStatus
+	currentStatus = status
+	statusMu.Unlock()
+
+	return func() {
+		statusMu.Lock()
+		currentStatus = previous
+		statusMu.Unlock()
+	}
+}
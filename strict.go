@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var ReadOnlySource = false
+
+var ErrNoDestination = errors.New("--read-only-source needs a destination outside the source, e.g. --output DIR or --cas DIR")
+
+func IsWithin(path, root string) bool {
+	path, err := filepath.Abs(path)
+
+	if err != nil {
+		return false
+	}
+
+	root, err = filepath.Abs(root)
+
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(root, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// CheckReadOnlySource makes sure nothing avify writes in the strict mode lands
+// inside a source root, so the sources can live on snapshots or read-only
+// exports.
+func CheckReadOnlySource(roots []string, destinations ...string) error {
+	if CASDir == "" && OutputDir == "" {
+		return ErrNoDestination
+	}
+
+	for _, root := range roots {
+		for _, destination := range append(destinations, CASDir, OutputDir) {
+			if destination != "" && IsWithin(destination, root) {
+				return fmt.Errorf("%s is inside the read-only source %s", destination, root)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+var (
+	RasterizeSVG = false
+	SVGDensity   = 72
+	SVGWidth     = 0
+)
+
+func IsSVG(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".svg"
+}
+
+func looksSVG(header []byte) bool {
+	return bytes.Contains(header, []byte("<svg"))
+}
+
+// decodeSVG renders the SVG with librsvg at --svg-density, or at the density
+// giving --svg-width pixels, so vectors are rasterized sharp rather than
+// rendered small and scaled up.
+func decodeSVG(r io.Reader) (Image, error) {
+	data, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := loadSVG(data, SVGDensity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if SVGWidth <= 0 || image.Width() == SVGWidth {
+		return image, nil
+	}
+
+	density := int(math.Ceil(float64(SVGDensity) * float64(SVGWidth) / float64(image.Width())))
+
+	image.Close()
+
+	if image, err = loadSVG(data, density); err != nil {
+		return nil, err
+	}
+
+	// The density is whole, so the width may still be off by a few pixels.
+	if image.Width() != SVGWidth {
+		if err := image.Resize(float64(SVGWidth)/float64(image.Width()), vips.KernelLanczos3); err != nil {
+			image.Close()
+
+			return nil, err
+		}
+	}
+
+	return image, nil
+}
+
+func loadSVG(data []byte, density int) (*vips.ImageRef, error) {
+	params := vips.NewImportParams()
+
+	params.Density.Set(density)
+
+	return vips.LoadImageFromBuffer(data, params)
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+const SyncIndexName = ".avify-sync.json"
+
+// SyncReplacedName lists, next to a sync index, the originals avify deleted
+// itself after converting them, so sync never takes their AVIFs for orphans.
+const SyncReplacedName = ".avify-sync-replaced"
+
+type SyncEntry struct {
+	Hash   string `json:"hash"`
+	NoGain bool   `json:"no_gain,omitempty"`
+}
+
+// UnmarshalJSON also reads indexes written before no-gain files were
+// recorded, which held the hash alone.
+func (e *SyncEntry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.Hash); err == nil {
+		return nil
+	}
+
+	type plain SyncEntry
+
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+type SyncIndex map[string]SyncEntry
+
+func LoadSyncIndex(path string) (SyncIndex, error) {
+	index := SyncIndex{}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return index, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return index, nil
+}
+
+func (i SyncIndex) Save(path string) error {
+	data, err := json.MarshalIndent(i, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func IsStale(original, output, hash string, indexed SyncEntry) bool {
+	if indexed.NoGain {
+		return indexed.Hash != hash
+	}
+
+	outputInfo, err := os.Stat(output)
+
+	if err != nil {
+		return true
+	}
+
+	originalInfo, err := os.Stat(original)
+
+	if err != nil {
+		return true
+	}
+
+	if originalInfo.ModTime().After(outputInfo.ModTime()) {
+		return true
+	}
+
+	return indexed.Hash != "" && indexed.Hash != hash
+}
+
+var (
+	syncMu    sync.Mutex
+	syncRoots = map[string]string{}
+)
+
+// syncRoot is the nearest directory above dir, or dir itself, holding a sync
+// index, or an empty string.
+func syncRoot(dir string) string {
+	root, ok := syncRoots[dir]
+
+	if ok {
+		return root
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, SyncIndexName)); err == nil {
+		root = dir
+	} else if parent := filepath.Dir(dir); parent != dir {
+		root = syncRoot(parent)
+	}
+
+	syncRoots[dir] = root
+
+	return root
+}
+
+// RecordReplaced notes an original avify is about to delete in the nearest
+// sync index above it, if any.
+func RecordReplaced(path string) error {
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return err
+	}
+
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	root := syncRoot(filepath.Dir(abs))
+
+	if root == "" {
+		return nil
+	}
+
+	key, err := filepath.Rel(root, abs)
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(root, SyncReplacedName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(file, filepath.ToSlash(key)); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	return file.Close()
+}
+
+func LoadSyncReplaced(root string) (map[string]bool, error) {
+	data, err := os.ReadFile(filepath.Join(root, SyncReplacedName))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := map[string]bool{}
+
+	for _, key := range strings.Split(string(data), "\n") {
+		if key != "" {
+			replaced[key] = true
+		}
+	}
+
+	return replaced, nil
+}
+
+func NewSyncCmd() *cobra.Command {
+	var deleteOrphans bool
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "sync DIR",
+		Short: "Regenerate AVIFs whose originals changed and list or delete AVIFs whose originals were removed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := args[0]
+			indexPath := filepath.Join(root, SyncIndexName)
+
+			KeepOriginals = true
+
+			index, err := LoadSyncIndex(indexPath)
+
+			if err != nil {
+				return err
+			}
+
+			replaced, err := LoadSyncReplaced(root)
+
+			if err != nil {
+				return err
+			}
+
+			discovery, err := FindImagesAt(root)
+
+			if err != nil {
+				return err
+			}
+
+			seen := map[string]bool{}
+			hashes := map[string]string{}
+
+			var stale []*Job
+
+			for _, job := range discovery.Jobs {
+				key, err := filepath.Rel(root, job.Path)
+
+				if err != nil {
+					return err
+				}
+
+				key = filepath.ToSlash(key)
+				seen[key] = true
+
+				hash, err := HashFile(job.Path)
+
+				if err != nil {
+					return err
+				}
+
+				job.Output = ReplaceExt(job.Path)
+
+				if IsStale(job.Path, job.Output, hash, index[key]) {
+					hashes[job.Path] = hash
+					stale = append(stale, job)
+				} else {
+					index[key] = SyncEntry{Hash: hash, NoGain: index[key].NoGain}
+				}
+			}
+
+			var orphans []string
+
+			orphaned := map[string]string{}
+
+			for _, key := range slices.Sorted(maps.Keys(index)) {
+				if seen[key] {
+					continue
+				}
+
+				original := filepath.Join(root, filepath.FromSlash(key))
+
+				// Originals filtered out of this discovery are still there,
+				// and those avify replaced left their AVIF as the only copy.
+				if _, err := os.Lstat(original); err == nil {
+					continue
+				}
+
+				if replaced[key] || index[key].NoGain {
+					delete(index, key)
+
+					continue
+				}
+
+				output := ReplaceExt(original)
+
+				if _, err := os.Stat(output); err != nil {
+					delete(index, key)
+
+					continue
+				}
+
+				orphans = append(orphans, output)
+				orphaned[output] = key
+			}
+
+			if dryRun {
+				PrintSyncDryRun(stale, orphans, deleteOrphans)
+
+				return nil
+			}
+
+			var removed []string
+
+			if deleteOrphans {
+				for _, output := range orphans {
+					if err := Audit(AuditDelete, output, "reason", "original removed"); err != nil {
+						return err
+					}
+
+					if err := ImageSink.Remove(output); err != nil && !errors.Is(err, fs.ErrNotExist) {
+						return err
+					}
+
+					delete(index, orphaned[output])
+
+					removed = append(removed, output)
+				}
+			}
+
+			var stats *Stats
+
+			if len(stale) > 0 {
+				ctx, cancel := InterruptContext(context.Background())
+
+				stats = ConvertImages(ctx, stale)
+
+				cancel()
+
+				for _, result := range stats.Results {
+					if result.Status != StatusConverted && result.Status != StatusNoGain {
+						continue
+					}
+
+					key, _ := filepath.Rel(root, result.Path)
+
+					index[filepath.ToSlash(key)] = SyncEntry{Hash: hashes[result.Path], NoGain: result.Status == StatusNoGain}
+				}
+			}
+
+			if err := index.Save(indexPath); err != nil {
+				return err
+			}
+
+			if err := os.Remove(filepath.Join(root, SyncReplacedName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+
+			fmt.Printf("Up to date: %d\n", len(discovery.Jobs)-len(stale))
+
+			if stats != nil {
+				fmt.Printf("Regenerated: %d\n", len(stats.Results)-len(stats.Failed)-len(stats.NoGain))
+
+				if len(stats.Results) < len(stale) {
+					fmt.Printf("Interrupted: %d\n", len(stale)-len(stats.Results))
+				}
+
+				if len(stats.Failed) > 0 {
+					fmt.Println("Following files are failed:")
+
+					for _, path := range stats.Failed {
+						fmt.Printf("\t%s\n", path)
+					}
+				}
+			}
+
+			if len(removed) > 0 {
+				fmt.Println("Following AVIFs are deleted because their originals are gone:")
+
+				for _, path := range removed {
+					fmt.Printf("\t%s\n", path)
+				}
+			} else if len(orphans) > 0 {
+				fmt.Println("Following AVIFs have lost their originals, --delete-orphans deletes them:")
+
+				for _, path := range orphans {
+					fmt.Printf("\t%s\n", path)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&deleteOrphans, "delete-orphans", false, "delete AVIFs whose originals were removed, other than by avify itself")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "n", false, "only list what would be regenerated and deleted")
+
+	return cmd
+}
+
+func PrintSyncDryRun(stale []*Job, orphans []string, deleteOrphans bool) {
+	if len(stale) > 0 {
+		fmt.Println("Following AVIFs would be regenerated:")
+
+		for _, job := range stale {
+			fmt.Printf("\t%s\n", job.Output)
+		}
+	}
+
+	if len(orphans) == 0 {
+		return
+	}
+
+	if deleteOrphans {
+		fmt.Println("Following AVIFs would be deleted because their originals are gone:")
+	} else {
+		fmt.Println("Following AVIFs have lost their originals, --delete-orphans deletes them:")
+	}
+
+	for _, path := range orphans {
+		fmt.Printf("\t%s\n", path)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var MaxLoad = 0.0
+
+var MaxTemperature = 0.0
+
+var ThrottleInterval = 10 * time.Second
+
+// Workers only grow back once the load drops below this share of MaxLoad,
+// or the temperature this many degrees below MaxTemperature, so the pool
+// doesn't flap around the threshold.
+const (
+	loadHysteresis        = 0.8
+	temperatureHysteresis = 5.0
+)
+
+var (
+	ErrNoLoadAverage = errors.New("load average is not available on this platform")
+	ErrNoTemperature = errors.New("CPU temperature is not available on this machine")
+)
+
+func CheckThrottle() error {
+	if MaxLoad > 0 {
+		if _, err := LoadAverage(); err != nil {
+			return err
+		}
+	}
+
+	if MaxTemperature > 0 {
+		if _, err := CPUTemperature(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ThrottleState tells whether the machine is over a threshold, or cool
+// enough to run more workers again.
+func ThrottleState() (hot bool, cool bool) {
+	cool = true
+
+	if MaxLoad > 0 {
+		if load, err := LoadAverage(); err == nil {
+			hot = hot || load > MaxLoad
+			cool = cool && load < MaxLoad*loadHysteresis
+		}
+	}
+
+	if MaxTemperature > 0 {
+		if temperature, err := CPUTemperature(); err == nil {
+			hot = hot || temperature > MaxTemperature
+			cool = cool && temperature < MaxTemperature-temperatureHysteresis
+		}
+	}
+
+	return hot, cool
+}
+
+// Throttle removes a worker every ThrottleInterval while the machine is hot,
+// and gives them back one by one once it cools down.
+func Throttle(workers *Workers) func() {
+	if MaxLoad <= 0 && MaxTemperature <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(ThrottleInterval)
+
+		defer ticker.Stop()
+
+		removed := 0
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			hot, cool := ThrottleState()
+
+			switch {
+			case hot && workers.Limit() > 1:
+				workers.Adjust(-1)
+
+				removed += 1
+			case cool && removed > 0:
+				workers.Adjust(1)
+
+				removed -= 1
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var Timeout time.Duration
+
+var ErrTimeout = errors.New("timeout")
+
+// Commit is called once the output is ready to be written. It fails when the
+// conversion already timed out, so a late conversion never writes over or
+// deletes anything, and once it succeeds the conversion can't time out.
+func (j *Job) Commit() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.expired {
+		return ErrTimeout
+	}
+
+	j.committed = true
+
+	return nil
+}
+
+func (j *Job) expire() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.committed {
+		j.expired = true
+	}
+
+	return j.expired
+}
+
+// ConvertWithTimeout gives up on a conversion taking longer than --timeout,
+// so a corrupt or enormous image doesn't hold a worker forever. libvips can't
+// be interrupted, so the conversion goes on in the background until it ends,
+// but it is not allowed to write its output.
+func ConvertWithTimeout(job *Job) (*Result, error) {
+	if Timeout <= 0 {
+		return ConvertRecovered(job)
+	}
+
+	type outcome struct {
+		result *Result
+		err    error
+	}
+
+	done := make(chan outcome, 1)
+
+	go func() {
+		result, err := ConvertRecovered(job)
+
+		done <- outcome{result, err}
+	}()
+
+	timer := time.NewTimer(Timeout)
+
+	defer timer.Stop()
+
+	select {
+	case outcome := <-done:
+		return outcome.result, outcome.err
+	case <-timer.C:
+		if job.expire() {
+			return nil, ErrTimeout
+		}
+
+		// The output is being written already, which is quick.
+		outcome := <-done
+
+		return outcome.result, outcome.err
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Timings struct {
+	Discovery    time.Duration
+	Conversion   time.Duration
+	Verification time.Duration
+	CPU          time.Duration
+	Total        time.Duration
+}
+
+func (t *Timings) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]float64{
+		"discovery_seconds":    t.Discovery.Seconds(),
+		"conversion_seconds":   t.Conversion.Seconds(),
+		"verification_seconds": t.Verification.Seconds(),
+		"cpu_seconds":          t.CPU.Seconds(),
+		"total_seconds":        t.Total.Seconds(),
+	})
+}
+
+func (t *Timings) Print() {
+	fmt.Printf("Total time: %s (discovery %s, conversion %s)\n", t.Total.Round(time.Millisecond), t.Discovery.Round(time.Millisecond), t.Conversion.Round(time.Millisecond))
+
+	if t.Verification > 0 {
+		fmt.Printf("Verification time: %s across workers\n", t.Verification.Round(time.Millisecond))
+	}
+
+	if t.CPU > 0 && t.Total > 0 {
+		fmt.Printf("CPU time: %s (%.1f cores busy on average)\n", t.CPU.Round(time.Millisecond), t.CPU.Seconds()/t.Total.Seconds())
+	}
+}
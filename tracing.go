@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var OtelEndpoint = ""
+
+const traceBatchSize = 512
+
+type Span struct {
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	start      time.Time
+	attributes []string
+}
+
+var tracer struct {
+	mu    sync.Mutex
+	wg    sync.WaitGroup
+	spans []map[string]any
+}
+
+// TraceRoot is the span of the whole run, parent of everything else.
+var TraceRoot *Span
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// StartSpan starts a span under parent with key/value attributes. Without an
+// OTLP endpoint it returns nil, and ending a nil span does nothing.
+func StartSpan(parent *Span, name string, attributes ...string) *Span {
+	if OtelEndpoint == "" {
+		return nil
+	}
+
+	span := &Span{spanID: randomHex(8), name: name, start: time.Now(), attributes: attributes}
+
+	if parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		span.traceID = randomHex(16)
+	}
+
+	return span
+}
+
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	attributes := []map[string]any{}
+
+	for i := 0; i+1 < len(s.attributes); i += 2 {
+		attributes = append(attributes, map[string]any{"key": s.attributes[i], "value": map[string]any{"stringValue": s.attributes[i+1]}})
+	}
+
+	status := map[string]any{"code": 1}
+
+	if err != nil {
+		status = map[string]any{"code": 2, "message": err.Error()}
+	}
+
+	span := map[string]any{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"parentSpanId":      s.parentID,
+		"name":              s.name,
+		"kind":              1,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(time.Now().UnixNano(), 10),
+		"attributes":        attributes,
+		"status":            status,
+	}
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+
+	tracer.spans = append(tracer.spans, span)
+
+	if len(tracer.spans) >= traceBatchSize {
+		flushSpans()
+	}
+}
+
+// flushSpans sends buffered spans in the background. It must be called with
+// tracer.mu held.
+func flushSpans() {
+	if len(tracer.spans) == 0 {
+		return
+	}
+
+	spans := tracer.spans
+
+	tracer.spans = nil
+	tracer.wg.Add(1)
+
+	go func() {
+		defer tracer.wg.Done()
+
+		if err := exportSpans(spans); err != nil {
+			fmt.Printf("Failed to export traces: %v\n", err)
+		}
+	}()
+}
+
+func exportSpans(spans []map[string]any) error {
+	payload := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []any{
+					map[string]any{"key": "service.name", "value": map[string]any{"stringValue": "avify"}},
+					map[string]any{"key": "avify.run_id", "value": map[string]any{"stringValue": RunID}},
+				},
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "avify", "version": Version},
+				"spans": spans,
+			}},
+		}},
+	}
+
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(OtelEndpoint, "/") + "/v1/traces"
+
+	response, err := http.Post(url, "application/json", bytes.NewReader(data))
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", url, response.Status)
+	}
+
+	return nil
+}
+
+func ShutdownTracing() {
+	tracer.mu.Lock()
+	flushSpans()
+	tracer.mu.Unlock()
+
+	tracer.wg.Wait()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var TreeChecksum = false
+
+type TreeChecksums struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// TreeDigest is a Merkle digest of the tree under root: files hash their
+// content, symlinks their target, and directories the sorted names, types
+// and digests of their entries. Any change anywhere changes the root digest.
+func TreeDigest(root string) (string, error) {
+	info, err := os.Lstat(root)
+
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case info.Mode().IsRegular():
+		return HashFile(root)
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(root)
+
+		if err != nil {
+			return "", err
+		}
+
+		sum := sha256.Sum256([]byte(target))
+
+		return hex.EncodeToString(sum[:]), nil
+	case !info.IsDir():
+		return "", nil
+	}
+
+	entries, err := os.ReadDir(root)
+
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+
+	for _, entry := range entries {
+		digest, err := TreeDigest(filepath.Join(root, entry.Name()))
+
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(hash, "%s\x00%s\x00%s\n", entry.Name(), entry.Type().String(), digest)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// TreeDigests computes the digest of every root, for the before or after
+// side of the checksums.
+func TreeDigests(roots []string, checksums map[string]*TreeChecksums, after bool) error {
+	for _, root := range roots {
+		digest, err := TreeDigest(root)
+
+		if err != nil {
+			return err
+		}
+
+		if checksums[root] == nil {
+			checksums[root] = &TreeChecksums{}
+		}
+
+		if after {
+			checksums[root].After = digest
+		} else {
+			checksums[root].Before = digest
+		}
+	}
+
+	return nil
+}
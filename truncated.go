@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	truncationHead = 12
+	truncationTail = 1024
+)
+
+var (
+	jpegMagic  = []byte{0xff, 0xd8, 0xff}
+	jpegEnd    = []byte{0xff, 0xd9}
+	pngMagic   = []byte("\x89PNG\r\n\x1a\n")
+	pngEnd     = []byte("IEND\xae\x42\x60\x82")
+	gifMagic   = []byte("GIF8")
+	riffMagic  = []byte("RIFF")
+	webpMagic  = []byte("WEBP")
+	gifTrailer = byte(0x3b)
+)
+
+// IsTruncated reports images whose container is obviously cut short: JPEG
+// without an end marker, PNG without IEND, GIF without a trailer, or WebP
+// shorter than its RIFF header claims. Data appended after the end of the
+// image doesn't count. Unknown formats are left to libvips.
+func IsTruncated(path string, size int64) (bool, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer file.Close()
+
+	head := make([]byte, truncationHead)
+
+	n, err := io.ReadFull(file, head)
+
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	head = head[:n]
+
+	tail := make([]byte, min(size, truncationTail))
+
+	if _, err := file.ReadAt(tail, size-int64(len(tail))); err != nil && err != io.EOF {
+		return false, err
+	}
+
+	// A tail ending the image is the common case. Otherwise data may have
+	// been appended after the image, e.g. the video of a motion photo, so
+	// the structure is walked from the start to find where the image ends.
+	switch {
+	case bytes.HasPrefix(head, jpegMagic):
+		if bytes.Contains(tail, jpegEnd) {
+			return false, nil
+		}
+
+		return jpegTruncated(io.NewSectionReader(file, 0, size))
+	case bytes.HasPrefix(head, pngMagic):
+		if bytes.Contains(tail, pngEnd) {
+			return false, nil
+		}
+
+		return pngTruncated(file, size)
+	case bytes.HasPrefix(head, gifMagic):
+		if trimmed := bytes.TrimRight(tail, "\x00"); len(trimmed) > 0 && trimmed[len(trimmed)-1] == gifTrailer {
+			return false, nil
+		}
+
+		return gifTruncated(io.NewSectionReader(file, 0, size))
+	case bytes.HasPrefix(head, riffMagic) && bytes.Equal(head[8:12], webpMagic):
+		return int64(binary.LittleEndian.Uint32(head[4:8]))+8 > size, nil
+	}
+
+	return false, nil
+}
+
+// endOfData tells a file that ends before its image does from a read error.
+func endOfData(err error) (bool, error) {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true, nil
+	}
+
+	return false, err
+}
+
+// jpegTruncated skips segments by their length, and entropy-coded data up to
+// the next marker, until EOI.
+func jpegTruncated(r io.Reader) (bool, error) {
+	reader := bufio.NewReader(r)
+
+	if _, err := reader.Discard(len(jpegMagic) - 1); err != nil {
+		return endOfData(err)
+	}
+
+	for {
+		marker, err := nextJPEGMarker(reader)
+
+		if err != nil {
+			return endOfData(err)
+		}
+
+		switch {
+		case marker == jpegEnd[1]:
+			return false, nil
+		case marker >= 0xd0 && marker <= 0xd7 || marker == 0x01:
+			// RSTn and TEM have no length.
+			continue
+		}
+
+		var length [2]byte
+
+		if _, err := io.ReadFull(reader, length[:]); err != nil {
+			return endOfData(err)
+		}
+
+		if n := int(binary.BigEndian.Uint16(length[:])); n >= 2 {
+			if _, err := reader.Discard(n - 2); err != nil {
+				return endOfData(err)
+			}
+		}
+	}
+}
+
+// nextJPEGMarker skips to the next 0xff that is neither fill nor followed by
+// a stuffed zero.
+func nextJPEGMarker(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+
+		if err != nil {
+			return 0, err
+		}
+
+		if b != 0xff {
+			continue
+		}
+
+		for b == 0xff {
+			if b, err = reader.ReadByte(); err != nil {
+				return 0, err
+			}
+		}
+
+		if b != 0x00 {
+			return b, nil
+		}
+	}
+}
+
+// pngTruncated follows chunk lengths until IEND.
+func pngTruncated(file io.ReaderAt, size int64) (bool, error) {
+	offset := int64(len(pngMagic))
+	header := make([]byte, 8)
+
+	for {
+		if _, err := file.ReadAt(header, offset); err != nil {
+			return endOfData(err)
+		}
+
+		if string(header[4:]) == "IEND" {
+			return false, nil
+		}
+
+		offset += 12 + int64(binary.BigEndian.Uint32(header[:4]))
+
+		if offset > size {
+			return true, nil
+		}
+	}
+}
+
+// gifTruncated skips the color tables, extensions and image data of a GIF
+// until its trailer.
+func gifTruncated(r io.Reader) (bool, error) {
+	reader := bufio.NewReader(r)
+	screen := make([]byte, 13)
+
+	if _, err := io.ReadFull(reader, screen); err != nil {
+		return endOfData(err)
+	}
+
+	if err := skipColorTable(reader, screen[10]); err != nil {
+		return endOfData(err)
+	}
+
+	for {
+		block, err := reader.ReadByte()
+
+		if err != nil {
+			return endOfData(err)
+		}
+
+		switch block {
+		case gifTrailer:
+			return false, nil
+		case 0x21:
+			if _, err := reader.ReadByte(); err != nil {
+				return endOfData(err)
+			}
+		case 0x2c:
+			descriptor := make([]byte, 9)
+
+			if _, err := io.ReadFull(reader, descriptor); err != nil {
+				return endOfData(err)
+			}
+
+			if err := skipColorTable(reader, descriptor[8]); err != nil {
+				return endOfData(err)
+			}
+
+			// LZW minimum code size.
+			if _, err := reader.ReadByte(); err != nil {
+				return endOfData(err)
+			}
+		default:
+			// Not a GIF block, leave it to libvips.
+			return false, nil
+		}
+
+		if err := skipSubBlocks(reader); err != nil {
+			return endOfData(err)
+		}
+	}
+}
+
+func skipColorTable(reader *bufio.Reader, flags byte) error {
+	if flags&0x80 == 0 {
+		return nil
+	}
+
+	_, err := reader.Discard(3 << ((flags & 0x07) + 1))
+
+	return err
+}
+
+func skipSubBlocks(reader *bufio.Reader) error {
+	for {
+		size, err := reader.ReadByte()
+
+		if err != nil || size == 0 {
+			return err
+		}
+
+		if _, err := reader.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
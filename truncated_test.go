@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsTruncated(t *testing.T) {
+	tests := []struct {
+		name      string
+		truncated bool
+	}{
+		{"complete.jpg", false},
+		{"complete.png", false},
+		{"complete.gif", false},
+		// Motion photos and the like append data after the image.
+		{"trailer.jpg", false},
+		{"trailer.png", false},
+		{"trailer.gif", false},
+		{"truncated.jpg", true},
+		{"truncated.png", true},
+		{"truncated.gif", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join("testdata", test.name)
+			info, err := os.Stat(path)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			truncated, err := IsTruncated(path, info.Size())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if truncated != test.truncated {
+				t.Errorf("IsTruncated(%s) = %v, want %v", test.name, truncated, test.truncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var ForceUnsafePath = false
+
+var ErrUnsafePath = errors.New("refusing to touch a system location, pass --force-unsafe-path if this is intended")
+
+var unsafeRoots = []string{
+	"/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib64", "/opt", "/proc", "/sbin", "/sys", "/usr", "/var",
+	"/Applications", "/Library", "/System", "/Users", "/Volumes",
+}
+
+var unsafeDirs = map[string]bool{
+	"appdata":             true,
+	"program files":       true,
+	"program files (x86)": true,
+	"programdata":         true,
+	"system32":            true,
+	"node_modules":        true,
+	"site-packages":       true,
+}
+
+func resolve(path string) string {
+	abs, err := filepath.Abs(path)
+
+	if err != nil {
+		return path
+	}
+
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+
+	return abs
+}
+
+// CheckSafeRoot refuses filesystem roots, home directories and well-known
+// system locations, where a mistyped argument would be catastrophic.
+func CheckSafeRoot(root string) error {
+	if ForceUnsafePath {
+		return nil
+	}
+
+	path := resolve(root)
+
+	if filepath.Dir(path) == path {
+		return fmt.Errorf("%s: %w", root, ErrUnsafePath)
+	}
+
+	if home, err := os.UserHomeDir(); err == nil && path == resolve(home) {
+		return fmt.Errorf("%s: %w", root, ErrUnsafePath)
+	}
+
+	if runtime.GOOS == "windows" {
+		for _, name := range []string{"SystemRoot", "ProgramFiles", "ProgramFiles(x86)", "ProgramData"} {
+			if dir := os.Getenv(name); dir != "" && strings.EqualFold(path, resolve(dir)) {
+				return fmt.Errorf("%s: %w", root, ErrUnsafePath)
+			}
+		}
+
+		return nil
+	}
+
+	for _, dir := range unsafeRoots {
+		if path == dir {
+			return fmt.Errorf("%s: %w", root, ErrUnsafePath)
+		}
+	}
+
+	return nil
+}
+
+// IsUnsafeDir reports OS and application directories that should never be
+// found inside a photo tree.
+func IsUnsafeDir(name string) bool {
+	return !ForceUnsafePath && (unsafeDirs[strings.ToLower(name)] || strings.HasSuffix(name, ".app"))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const UsageExtensions = `\.(gif|jpg|jpeg|png|webp|avif|heic|heif|tif|tiff|bmp)$`
+
+type UsageEntry struct {
+	Count int
+	Size  uint64
+}
+
+func (e *UsageEntry) Add(size int64) {
+	e.Count += 1
+	e.Size += uint64(size)
+}
+
+type Usage struct {
+	Total   UsageEntry
+	Other   UsageEntry
+	Formats map[string]*UsageEntry
+	Dirs    map[string]*UsageEntry
+}
+
+func usageEntry(entries map[string]*UsageEntry, key string) *UsageEntry {
+	entry, ok := entries[key]
+
+	if !ok {
+		entry = &UsageEntry{}
+		entries[key] = entry
+	}
+
+	return entry
+}
+
+// DiskUsage sums the size of images under root by format and by directory,
+// grouping directories depth levels below root.
+func DiskUsage(root string, depth int) (*Usage, error) {
+	r := regexp.MustCompile(UsageExtensions)
+
+	usage := &Usage{Formats: map[string]*UsageEntry{}, Dirs: map[string]*UsageEntry{}}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		if !r.MatchString(strings.ToLower(path)) {
+			usage.Other.Add(info.Size())
+
+			return nil
+		}
+
+		usage.Total.Add(info.Size())
+		usageEntry(usage.Formats, SourceFormat(path)).Add(info.Size())
+		usageEntry(usage.Dirs, usageDir(root, path, depth)).Add(info.Size())
+
+		return nil
+	})
+
+	return usage, err
+}
+
+func usageDir(root, path string, depth int) string {
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+
+	if err != nil || rel == "." {
+		return "."
+	}
+
+	parts := strings.Split(rel, string(filepath.Separator))
+
+	return filepath.Join(parts[:min(depth, len(parts))]...)
+}
+
+func (u *Usage) Print() {
+	printEntries := func(title string, entries map[string]*UsageEntry) {
+		fmt.Println(title)
+
+		keys := slices.SortedFunc(maps.Keys(entries), func(a, b string) int {
+			return cmp.Or(cmp.Compare(entries[b].Size, entries[a].Size), cmp.Compare(a, b))
+		})
+
+		for _, key := range keys {
+			entry := entries[key]
+
+			fmt.Printf("\t%s: %s in %d files (%.1f%%)\n", key, FormatBytes(entry.Size), entry.Count, float64(entry.Size)/float64(u.Total.Size)*100)
+		}
+	}
+
+	fmt.Printf("Images: %s in %d files\n", FormatBytes(u.Total.Size), u.Total.Count)
+
+	if u.Other.Count > 0 {
+		fmt.Printf("Other files: %s in %d files\n", FormatBytes(u.Other.Size), u.Other.Count)
+	}
+
+	if u.Total.Count == 0 {
+		return
+	}
+
+	printEntries("By format:", u.Formats)
+	printEntries("By directory:", u.Dirs)
+}
+
+func NewUsageCmd() *cobra.Command {
+	var depth int
+
+	cmd := &cobra.Command{
+		Use:   "usage DIR",
+		Short: "Summarize disk usage of images in DIR by format and directory, without converting anything",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if depth < 1 {
+				return fmt.Errorf("invalid depth %d", depth)
+			}
+
+			usage, err := DiskUsage(args[0], depth)
+
+			if err != nil {
+				return err
+			}
+
+			usage.Print()
+
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&depth, "depth", 1, "group directories `N` levels below DIR")
+
+	return cmd
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/demiazz/avify/convert"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+)
+
+type watchState struct {
+	size     int64
+	modified time.Time
+	since    time.Time
+}
+
+func (s watchState) Same(info os.FileInfo) bool {
+	return s.size == info.Size() && s.modified.Equal(info.ModTime())
+}
+
+// Watcher finds images that appeared or changed under Root, and hands them
+// out once they kept their size and modification time for Settle, so files
+// still being copied are not converted half-written. It learns about changes
+// from the file system events once Watch succeeds, and rescans the whole
+// tree on every poll otherwise.
+type Watcher struct {
+	Root   string
+	Settle time.Duration
+
+	events  *fsnotify.Watcher
+	changed []string
+	pending map[string]watchState
+	handled map[string]watchState
+}
+
+func NewWatcher(root string, settle time.Duration) *Watcher {
+	return &Watcher{Root: root, Settle: settle, pending: map[string]watchState{}, handled: map[string]watchState{}}
+}
+
+// Watch subscribes to the events of every directory under Root. It fails
+// where the platform has no file system events, or when the directories
+// can't all be watched, e.g. over the inotify limit, and the watcher keeps
+// rescanning then.
+func (w *Watcher) Watch() error {
+	events, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		return err
+	}
+
+	w.events = events
+
+	if err := w.watchTree(w.Root); err != nil {
+		w.Close()
+
+		return err
+	}
+
+	return nil
+}
+
+func (w *Watcher) Close() error {
+	if w.events == nil {
+		return nil
+	}
+
+	err := w.events.Close()
+
+	w.events = nil
+
+	return err
+}
+
+// watchTree watches dir and the directories below it. The files already in
+// there count as changed, since they may have been moved in with dir before
+// it was watched.
+func (w *Watcher) watchTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return w.events.Add(path)
+		}
+
+		w.changed = append(w.changed, path)
+
+		return nil
+	})
+}
+
+// drain takes the events received since the last poll, and returns the
+// paths they are about.
+func (w *Watcher) drain() ([]string, error) {
+	for {
+		select {
+		case event := <-w.events.Events:
+			switch {
+			case event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename):
+				delete(w.pending, event.Name)
+				delete(w.handled, event.Name)
+			case event.Has(fsnotify.Create):
+				if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+					if err := w.watchTree(event.Name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+						return nil, err
+					}
+
+					continue
+				}
+
+				w.changed = append(w.changed, event.Name)
+			default:
+				w.changed = append(w.changed, event.Name)
+			}
+		case err := <-w.events.Errors:
+			// Events were lost, so anything may have changed.
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				if err := w.watchTree(w.Root); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			return nil, err
+		default:
+			changed := w.changed
+
+			w.changed = nil
+
+			return changed, nil
+		}
+	}
+}
+
+// scan walks the whole tree, and forgets the files that are gone.
+func (w *Watcher) scan() ([]string, error) {
+	discovery, err := WalkImages(w.Root, convert.QuietObserver{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+
+	var paths []string
+
+	for _, job := range discovery.Jobs {
+		found[job.Path] = true
+		paths = append(paths, job.Path)
+	}
+
+	for path := range w.pending {
+		if !found[path] {
+			delete(w.pending, path)
+		}
+	}
+
+	for path := range w.handled {
+		if !found[path] {
+			delete(w.handled, path)
+		}
+	}
+
+	return paths, nil
+}
+
+func (w *Watcher) Poll() ([]*Job, error) {
+	var changed []string
+	var err error
+
+	if w.events != nil {
+		changed, err = w.drain()
+	} else {
+		changed, err = w.scan()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	paths := map[string]bool{}
+
+	for _, path := range changed {
+		paths[path] = true
+	}
+
+	for path := range w.pending {
+		paths[path] = true
+	}
+
+	var ready []string
+
+	for path := range paths {
+		info, err := os.Stat(path)
+
+		if err != nil || info.IsDir() {
+			delete(w.pending, path)
+
+			continue
+		}
+
+		if state, ok := w.handled[path]; ok && state.Same(info) {
+			continue
+		}
+
+		state, ok := w.pending[path]
+
+		if !ok || !state.Same(info) {
+			w.pending[path] = watchState{size: info.Size(), modified: info.ModTime(), since: now}
+
+			continue
+		}
+
+		if now.Sub(state.since) < w.Settle {
+			continue
+		}
+
+		ready = append(ready, path)
+
+		w.handled[path] = state
+
+		delete(w.pending, path)
+	}
+
+	if len(ready) == 0 {
+		return nil, nil
+	}
+
+	slices.Sort(ready)
+
+	// Settings and ignore files may have changed since the last batch, so
+	// every batch is admitted afresh.
+	admission, err := NewAdmission(w.Root, convert.QuietObserver{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range ready {
+		if err := admission.AdmitListed(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return admission.Discovery.Jobs, nil
+}
+
+// watchControl lets watch be paused and its batches cancelled over D-Bus.
+// Images that settle while watch is paused are held until it resumes.
+type watchControl struct {
+	mu      sync.Mutex
+	held    []*Job
+	running int
+	paused  bool
+	cancel  context.CancelFunc
+	state   DaemonState
+}
+
+func (c *watchControl) Status() *DaemonState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := c.state
+
+	state.Queued = len(c.held)
+	state.Running = c.running
+
+	switch {
+	case c.paused:
+		state.State = DaemonPaused
+	case c.running > 0:
+		state.State = DaemonRunning
+	default:
+		state.State = DaemonIdle
+	}
+
+	return &state
+}
+
+// Pause stops the current batch after the conversions in flight, and holds
+// the rest until Resume.
+func (c *watchControl) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = true
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+func (c *watchControl) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = false
+}
+
+// Cancel stops the current batch after the conversions in flight, and drops
+// the images held.
+func (c *watchControl) Cancel() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.held = nil
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
+// take returns the batch to convert now with its context, which is empty
+// while paused.
+func (c *watchControl) take(ctx context.Context, ready []*Job) ([]*Job, context.Context, context.CancelFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.held = append(c.held, ready...)
+
+	if c.paused || len(c.held) == 0 {
+		return nil, ctx, func() {}
+	}
+
+	jobs := c.held
+	batchCtx, cancel := context.WithCancel(ctx)
+
+	c.held = nil
+	c.running = len(jobs)
+	c.cancel = cancel
+
+	return jobs, batchCtx, cancel
+}
+
+func (c *watchControl) finish(jobs []*Job, stats *Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.running = 0
+	c.cancel = nil
+	c.state.Failed += len(stats.Failed)
+
+	processed := map[string]bool{}
+
+	for _, result := range stats.Results {
+		processed[result.Path] = true
+
+		if result.Status == StatusConverted {
+			c.state.Converted += 1
+		}
+	}
+
+	if !c.paused {
+		return
+	}
+
+	var left []*Job
+
+	for _, job := range jobs {
+		if !processed[job.Path] {
+			left = append(left, job)
+		}
+	}
+
+	c.held = append(left, c.held...)
+}
+
+func NewWatchCmd() *cobra.Command {
+	var interval time.Duration
+	var settle time.Duration
+	var poll bool
+	var dbus bool
+
+	cmd := &cobra.Command{
+		Use:   "watch DIR",
+		Short: "Convert images as they appear in DIR",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if interval <= 0 || settle < 0 {
+				return fmt.Errorf("invalid interval %v or settle delay %v", interval, settle)
+			}
+
+			watcher := NewWatcher(args[0], settle)
+
+			if !poll {
+				if err := watcher.Watch(); err != nil {
+					fmt.Fprintf(os.Stderr, "Can't watch %s for changes (%v), scanning it every %v instead\n", args[0], err, interval)
+				}
+			}
+
+			defer watcher.Close()
+
+			ctx, cancel := InterruptContext(cmd.Context())
+
+			defer cancel()
+
+			fmt.Printf("Watching %s\n", args[0])
+
+			control := &watchControl{}
+
+			if dbus {
+				release, err := ExportDBus(control)
+
+				if err != nil {
+					return err
+				}
+
+				defer release()
+			}
+
+			for ctx.Err() == nil {
+				ready, err := watcher.Poll()
+
+				if err != nil {
+					return err
+				}
+
+				if jobs, batchCtx, cancel := control.take(ctx, ready); len(jobs) > 0 {
+					restore := ApplySchedule(time.Now())
+
+					PlanOutputs(jobs)
+
+					stats := ConvertImages(batchCtx, jobs)
+
+					restore()
+					cancel()
+					control.finish(jobs, stats)
+
+					stats.PrintSummary()
+				}
+
+				select {
+				case <-ctx.Done():
+				case <-time.After(interval):
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&interval, "interval", 2*time.Second, "how often to check for settled images, or to scan DIR without file system events")
+	cmd.Flags().BoolVar(&poll, "poll", false, "scan DIR instead of using file system events, e.g. on network file systems")
+	cmd.Flags().BoolVar(&dbus, "dbus", false, "report progress and take pause, resume and cancel requests on the D-Bus session bus, Linux only")
+	cmd.Flags().DurationVar(&settle, "settle", 5*time.Second, "convert a new image once its size and modification time stayed the same for this long")
+
+	return cmd
+}
@@ -0,0 +1,70 @@
+//go:build fake
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/demiazz/avify/convert"
+)
+
+// runRoot runs the avify command line with args until done returns true, or
+// until it returns by itself when done is nil.
+func runRoot(t *testing.T, done func() bool, args ...string) {
+	t.Helper()
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	defer func(keep bool, output string, observer convert.Observer) {
+		KeepOriginals, OutputDir, RunObserver = keep, output, observer
+	}(KeepOriginals, OutputDir, RunObserver)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan error, 1)
+
+	cmd := NewRootCmd()
+
+	cmd.SetArgs(args)
+
+	go func() {
+		finished <- cmd.ExecuteContext(ctx)
+	}()
+
+	if done != nil {
+		for deadline := time.Now().Add(5 * time.Second); !done() && time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		}
+
+		cancel()
+	}
+
+	defer cancel()
+
+	if err := <-finished; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchKeep(t *testing.T) {
+	root := writeTree(t, map[string]string{"image.png": strings.Repeat("x", 4096)})
+	output := filepath.Join(root, "image.avif")
+
+	runRoot(t, func() bool {
+		_, err := os.Stat(output)
+
+		return err == nil
+	}, "watch", "--keep", "--poll", "--settle", "0", "--interval", "10ms", root)
+
+	if _, err := os.Stat(output); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "image.png")); err != nil {
+		t.Errorf("original removed despite --keep: %v", err)
+	}
+}
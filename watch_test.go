@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func pollUntil(t *testing.T, watcher *Watcher, want []string) {
+	t.Helper()
+
+	var got []string
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		jobs, err := watcher.Poll()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got = jobPaths(&Discovery{Jobs: jobs})
+
+		if len(got) > 0 {
+			break
+		}
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("ready %v, want %v", got, want)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	image, err := os.ReadFile(filepath.Join("testdata", "complete.png"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, events := range []bool{true, false} {
+		name := "poll"
+
+		if events {
+			name = "events"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			root := writeTree(t, map[string]string{"old.png": string(image), IgnoreFileName: "ignored/\n"})
+			watcher := NewWatcher(root, 0)
+
+			if events {
+				if err := watcher.Watch(); err != nil {
+					t.Skip(err)
+				}
+			}
+
+			defer watcher.Close()
+
+			pollUntil(t, watcher, []string{filepath.Join(root, "old.png")})
+
+			for _, name := range []string{"new/new.png", "ignored/new.png"} {
+				path := filepath.Join(root, filepath.FromSlash(name))
+
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(path, image, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			pollUntil(t, watcher, []string{filepath.Join(root, "new", "new.png")})
+		})
+	}
+}
+
+func TestWatchControl(t *testing.T) {
+	control := &watchControl{}
+	first, second := &Job{Path: "first.png"}, &Job{Path: "second.png"}
+
+	control.Pause()
+
+	if jobs, _, _ := control.take(context.Background(), []*Job{first, second}); len(jobs) != 0 {
+		t.Fatalf("paused watch converts %d images", len(jobs))
+	}
+
+	if state := control.Status(); state.State != DaemonPaused || state.Queued != 2 {
+		t.Errorf("status %+v, want paused with 2 queued", state)
+	}
+
+	control.Resume()
+
+	jobs, ctx, cancel := control.take(context.Background(), nil)
+
+	defer cancel()
+
+	if len(jobs) != 2 {
+		t.Fatalf("resumed watch converts %d images, want 2", len(jobs))
+	}
+
+	control.Pause()
+
+	if ctx.Err() == nil {
+		t.Error("pause doesn't stop the batch")
+	}
+
+	control.finish(jobs, &Stats{Results: []*Result{{Path: "first.png", Status: StatusConverted}}})
+
+	if state := control.Status(); state.Converted != 1 || state.Queued != 1 {
+		t.Errorf("status %+v, want 1 converted and the other image held", state)
+	}
+
+	control.Cancel()
+
+	if state := control.Status(); state.Queued != 0 {
+		t.Errorf("cancel keeps %d images", state.Queued)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+)
+
+var MaxConcurrency = runtime.NumCPU() * 2
+
+// Workers bounds the number of conversions running at once. The bound can be
+// changed while a batch runs, between one and MaxConcurrency; units above the
+// current bound are held by Workers itself.
+type Workers struct {
+	*semaphore.Weighted
+
+	limit   atomic.Int64
+	held    int
+	changes chan int
+	cancel  context.CancelFunc
+}
+
+func NewWorkers(limit int) *Workers {
+	capacity := max(limit, MaxConcurrency)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	w := &Workers{
+		Weighted: semaphore.NewWeighted(int64(capacity)),
+		held:     capacity - limit,
+		changes:  make(chan int, 16),
+		cancel:   cancel,
+	}
+
+	w.TryAcquire(int64(w.held))
+	w.limit.Store(int64(limit))
+
+	go w.adjust(ctx)
+
+	return w
+}
+
+func (w *Workers) Limit() int {
+	return int(w.limit.Load())
+}
+
+// Adjust asks to run delta more (or fewer) conversions at once. Shrinking
+// waits for running conversions to finish, it never interrupts them.
+func (w *Workers) Adjust(delta int) {
+	select {
+	case w.changes <- delta:
+	default:
+	}
+}
+
+var (
+	workersMu      sync.Mutex
+	currentWorkers *Workers
+)
+
+// AdjustWorkers makes the worker signals adjust workers until the returned
+// function is called.
+func AdjustWorkers(workers *Workers) func() {
+	workersMu.Lock()
+	previous := currentWorkers
+	currentWorkers = workers
+	workersMu.Unlock()
+
+	return func() {
+		workersMu.Lock()
+		currentWorkers = previous
+		workersMu.Unlock()
+	}
+}
+
+func (w *Workers) Stop() {
+	w.cancel()
+}
+
+func (w *Workers) adjust(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delta := <-w.changes:
+			for ; delta < 0 && w.Limit() > 1; delta++ {
+				if err := w.Acquire(ctx, 1); err != nil {
+					return
+				}
+
+				w.held += 1
+				w.limit.Add(-1)
+			}
+
+			for ; delta > 0 && w.held > 0; delta-- {
+				w.Release(1)
+
+				w.held -= 1
+				w.limit.Add(1)
+			}
+		}
+	}
+}
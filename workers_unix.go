@@ -0,0 +1,42 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var notifyWorkers sync.Once
+
+// NotifyWorkers lets SIGUSR1 decrease and SIGUSR2 increase the number of
+// workers of a running batch. The default action of both is to terminate, so
+// the handler stays installed for the whole life of the process, and an idle
+// watch or daemon ignores them.
+func NotifyWorkers() {
+	notifyWorkers.Do(func() {
+		signals := make(chan os.Signal, 1)
+
+		signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+		go func() {
+			for sig := range signals {
+				workersMu.Lock()
+				workers := currentWorkers
+				workersMu.Unlock()
+
+				if workers == nil {
+					continue
+				}
+
+				if sig == syscall.SIGUSR1 {
+					workers.Adjust(-1)
+				} else {
+					workers.Adjust(1)
+				}
+			}
+		}()
+	})
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNotifyWorkers(t *testing.T) {
+	NotifyWorkers()
+
+	// Nothing runs: the signal must neither kill the process nor block.
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+
+	workers := NewWorkers(2)
+
+	defer workers.Stop()
+	defer AdjustWorkers(workers)()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); workers.Limit() != 1; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d workers after SIGUSR1, want 1", workers.Limit())
+		}
+	}
+}
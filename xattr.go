@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/demiazz/avify/internal/vips"
+)
+
+var UseXattrs = false
+
+const (
+	XattrVersion  = "user.avify.version"
+	XattrSettings = "user.avify.settings"
+	XattrSkipped  = "user.avify.skipped"
+)
+
+// SettingsHash identifies everything that changes the output of a source,
+// so a later run can tell whether a marker still applies.
+func SettingsHash(params *vips.AvifExportParams) string {
+	settings := fmt.Sprintf("q=%d e=%d l=%t ssim=%g small=%d@%d large=%d@%d icc=%s pm=%t bleed=%t/%g brand=%s",
+		params.Quality, params.Effort, params.Lossless, TargetSSIM,
+		SmallQuality, SmallThreshold, LargeQuality, LargeThreshold,
+		EmbedICC, Premultiply, AlphaBleed, AlphaBleedSigma, AvifBrand)
+
+	sum := sha256.Sum256([]byte(settings))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// MarkOutput tags an AVIF written by avify with its version and settings.
+// Markers are best effort: filesystems without xattrs just don't get them.
+func MarkOutput(path string, params *vips.AvifExportParams) {
+	setXattr(path, XattrVersion, Version)
+	setXattr(path, XattrSettings, SettingsHash(params))
+}
+
+// MarkSkipped tags an original that was left alone, so the next run with the
+// same settings skips it without encoding it again.
+func MarkSkipped(path, reason string, params *vips.AvifExportParams) {
+	setXattr(path, XattrSkipped, reason)
+	setXattr(path, XattrSettings, SettingsHash(params))
+}
+
+func IsMarkedSkipped(path string, params *vips.AvifExportParams) bool {
+	reason, err := getXattr(path, XattrSkipped)
+
+	if err != nil || reason == "" {
+		return false
+	}
+
+	settings, err := getXattr(path, XattrSettings)
+
+	return err == nil && settings == SettingsHash(params)
+}
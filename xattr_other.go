@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+func setXattr(path, name, value string) error {
+	return errors.ErrUnsupported
+}
+
+func getXattr(path, name string) (string, error) {
+	return "", errors.ErrUnsupported
+}
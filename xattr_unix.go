@@ -0,0 +1,21 @@
+//go:build linux || darwin
+
+package main
+
+import "golang.org/x/sys/unix"
+
+func setXattr(path, name, value string) error {
+	return unix.Setxattr(path, name, []byte(value), 0)
+}
+
+func getXattr(path, name string) (string, error) {
+	buffer := make([]byte, 256)
+
+	n, err := unix.Getxattr(path, name, buffer)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(buffer[:n]), nil
+}